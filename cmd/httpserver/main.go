@@ -1,20 +1,23 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"log/slog"
+	"net"
+	"net/netip"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/fileserver"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/proxy"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/server"
@@ -23,137 +26,416 @@ import (
 
 func main() {
 	const port = 42069
-	server, err := server.Serve(port, handler)
+	logger := newLogger(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	// log.Printf passe aussi par là
+	slog.SetDefault(logger)
+	var stopChecks func()
+	httpbin, stopChecks = newProxy(os.Getenv("HTTPBIN_URL"), "https://httpbin.org", "/httpbin")
+	defer stopChecks()
+
+	opts := []server.Option{
+		server.WithCompression(),
+		server.WithRequestDecompression(maxUploadSize),
+		server.WithLogger(logger),
+	}
+	if mode := os.Getenv("PROXY_PROTOCOL"); mode != "" {
+		opts = append(opts, proxyProtocol(mode, os.Getenv("PROXY_TRUSTED")))
+	}
+	if certs := loadCerts(os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")); certs != nil {
+		defer certs.Watch(time.Minute)()
+		opts = append(opts, server.WithTLS(certs.TLSConfig()))
+		if caFile := os.Getenv("CLIENT_CA"); caFile != "" {
+			cas, err := server.LoadCAs(caFile)
+			if err != nil {
+				log.Fatalf("Error loading the client CAs: %v", err)
+			}
+			opts = append(opts, server.WithClientAuth(cas, false))
+			upload = server.RequireClientCert(uploadHandler)
+		}
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGHUP)
+
+	// sockets passés par systemd ou par le processus qu'on remplace
+	listeners, err := server.InheritedListeners()
+	if err != nil {
+		log.Fatalf("Error inheriting the listeners: %v", err)
+	}
+	if len(listeners) == 0 {
+		listeners = listen(os.Getenv("LISTEN"), port)
+	}
+	var h server.Handler = handler
+	var accessOut io.WriteCloser
+	if path := os.Getenv("ACCESS_LOG"); path != "" {
+		var format server.LogFormat
+		accessOut, format = accessLog(path, os.Getenv("ACCESS_LOG_FORMAT"), os.Getenv("ACCESS_LOG_MAX_MB"))
+		defer accessOut.Close()
+		h = server.AccessLog(handler, accessOut, format)
+	}
+	srv, err := server.ServeListeners(h, listeners, opts...)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	for _, l := range srv.Listeners {
+		log.Println("Server started on", l.Addr())
+	}
+	err = server.SignalReady()
+	if err != nil {
+		log.Println("Error signaling the previous process:", err)
+	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	// SIGUSR2 hands the listeners to a new binary, then drains like on
+	// SIGINT and SIGTERM. SIGHUP starts a new access log, Watch reloads the
+	// certificates on it too.
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			if f, ok := accessOut.(*server.RotatingFile); ok {
+				err := f.Rotate()
+				if err != nil {
+					log.Println("Error rotating the access log:", err)
+				}
+			}
+			continue
+		}
+		if sig != syscall.SIGUSR2 {
+			break
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := srv.Upgrade(ctx)
+		cancel()
+		if err == nil {
+			log.Println("Listeners handed over to the new process")
+			break
+		}
+		log.Println("Error upgrading:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		log.Println("Connections still open after", drainTimeout)
+	}
 	log.Println("Server gracefully stopped")
 }
 
-func handler(w response.Writer, req *request.Request) {
-	if req.RequestLine.Method != "GET" {
+// newLogger logs at level, debug, info (the default), warn, error or off,
+// as text or as json lines depending on format.
+func newLogger(level, format string) *slog.Logger {
+	if level == "off" {
+		return slog.New(slog.DiscardHandler)
+	}
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			log.Fatalf("Error parsing LOG_LEVEL: %v", err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts))
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	default:
+		log.Fatalf("LOG_FORMAT must be text or json, not %s", format)
+		return nil
+	}
+}
+
+// accessLogBackups is the number of rotated access logs kept.
+const accessLogBackups = 5
+
+// stdout is the standard output as an access log, left open by Close.
+type stdout struct {
+	io.Writer
+}
+
+func (stdout) Close() error {
+	return nil
+}
+
+// accessLog opens the access log at path, "-" for the standard output,
+// rotated every maxMB megabytes, 100 when empty.
+func accessLog(path, format, maxMB string) (io.WriteCloser, server.LogFormat) {
+	f, err := server.ParseLogFormat(format)
+	if err != nil {
+		log.Fatalf("Error parsing ACCESS_LOG_FORMAT: %v", err)
+	}
+	if path == "-" {
+		return stdout{os.Stdout}, f
+	}
+	size := 100
+	if maxMB != "" {
+		size, err = strconv.Atoi(maxMB)
+		if err != nil || size < 0 {
+			log.Fatalf("ACCESS_LOG_MAX_MB must be a number of megabytes, not %s", maxMB)
+		}
+	}
+	out, err := server.OpenRotatingFile(path, int64(size)<<20, accessLogBackups)
+	if err != nil {
+		log.Fatalf("Error opening the access log: %v", err)
+	}
+	return out, f
+}
+
+// drainTimeout bounds the wait for the requests in progress on shutdown.
+const drainTimeout = 30 * time.Second
+
+// listen opens the comma separated addresses of LISTEN, "unix:/path" ones
+// included, or port on every interface when it is empty.
+func listen(addrs string, port int) []net.Listener {
+	if addrs == "" {
+		addrs = ":" + strconv.Itoa(port)
+	}
+	listeners := []net.Listener{}
+	for _, addr := range strings.Split(addrs, ",") {
+		l, err := server.Listen(strings.TrimSpace(addr))
+		if err != nil {
+			log.Fatalf("Error listening on %s: %v", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// proxyProtocol reads the PROXY header of the load balancers, "required" or
+// "optional", from the comma separated networks of trusted only when it is
+// set.
+func proxyProtocol(mode, trusted string) server.Option {
+	if mode != "required" && mode != "optional" {
+		log.Fatalf("PROXY_PROTOCOL must be required or optional, not %s", mode)
+	}
+	prefixes := []netip.Prefix{}
+	if trusted != "" {
+		for _, cidr := range strings.Split(trusted, ",") {
+			p, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+			if err != nil {
+				log.Fatalf("Error parsing PROXY_TRUSTED: %v", err)
+			}
+			prefixes = append(prefixes, p)
+		}
+	}
+	return server.WithProxyProtocol(mode == "required", prefixes...)
+}
+
+// loadCerts reads the comma separated certificate and key files, the first
+// pair is served when the client asks for no known name. nil without
+// certificate, the server then speaks plain HTTP.
+func loadCerts(certFiles, keyFiles string) *server.CertStore {
+	if certFiles == "" {
+		return nil
+	}
+	certs := strings.Split(certFiles, ",")
+	keys := strings.Split(keyFiles, ",")
+	if len(certs) != len(keys) {
+		log.Fatalln("TLS_CERT and TLS_KEY must list as many files")
+	}
+	pairs := []server.KeyPair{}
+	for i := range certs {
+		pairs = append(pairs, server.KeyPair{
+			CertFile: strings.TrimSpace(certs[i]),
+			KeyFile:  strings.TrimSpace(keys[i]),
+		})
+	}
+	store, err := server.NewCertStore(pairs...)
+	if err != nil {
+		log.Fatalf("Error loading the certificates: %v", err)
+	}
+	return store
+}
+
+// httpbin forwards /httpbin/... to HTTPBIN_URL, https://httpbin.org by
+// default.
+var httpbin *proxy.ReverseProxy
+
+// newProxy mounts upstream on prefix. Several comma separated upstreams are
+// balanced with LB_STRATEGY (round-robin, least-conn, or hash of the client
+// IP or of LB_HASH_HEADER) and probed on LB_HEALTH_PATH when it is set.
+func newProxy(upstream, fallback, prefix string) (*proxy.ReverseProxy, func()) {
+	if upstream == "" {
+		upstream = fallback
+	}
+	upstreams := strings.Split(upstream, ",")
+	for i := range upstreams {
+		upstreams[i] = strings.TrimSpace(upstreams[i])
+	}
+	stop := func() {}
+
+	var p *proxy.ReverseProxy
+	if len(upstreams) == 1 {
+		var err error
+		p, err = proxy.New(upstreams[0])
+		if err != nil {
+			log.Fatalf("Error configuring the proxy: %v", err)
+		}
+	} else {
+		strategy, err := proxy.ParseStrategy(os.Getenv("LB_STRATEGY"))
+		if err != nil {
+			log.Fatalf("Error configuring the proxy: %v", err)
+		}
+		pool, err := proxy.NewPool(strategy, upstreams...)
+		if err != nil {
+			log.Fatalf("Error configuring the proxy: %v", err)
+		}
+		pool.HashHeader = os.Getenv("LB_HASH_HEADER")
+		if path := os.Getenv("LB_HEALTH_PATH"); path != "" {
+			stop = pool.StartHealthChecks(path, 5*time.Second, 2*time.Second)
+		}
+		p = proxy.NewBalanced(pool)
+	}
+	p.StripPrefix = prefix
+	p.ConnectTimeout = 5 * time.Second
+	p.ResponseHeaderTimeout = 30 * time.Second
+	p.Timeout = 5 * time.Minute
+	return p, stop
+}
+
+var assets = &fileserver.FileServer{
+	Root:     "assets",
+	Prefix:   "/assets",
+	ListDirs: true,
+}
+
+// upload serves /upload, only to the clients with a certificate signed by
+// CLIENT_CA when it is set.
+var upload server.Handler = uploadHandler
+
+func handler(w *response.Writer, req *request.Request) {
+	// les routes ne tiennent pas compte de la query
+	path := req.Path()
+	if path == "/upload" {
+		upload(w, req)
+		return
+	}
+	if strings.HasPrefix(path, "/assets/") {
+		assets.Handle(w, req)
+		return
+	}
+	if strings.HasPrefix(path, "/httpbin") {
+		httpbin.Handle(w, req)
+		return
+	}
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
 		okHandler(w, req)
+		return
 	}
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		proxyHandler(w, req)
-	} else if req.RequestLine.RequestTarget == "/yourproblem" {
+	if path == "/yourproblem" {
 		badRequestHandler(w, req)
-	} else if req.RequestLine.RequestTarget == "/myproblem" {
+	} else if path == "/myproblem" {
 		internalErrorHandler(w, req)
-	} else if req.RequestLine.RequestTarget == "/video" {
+	} else if path == "/video" {
 		videoHandler(w, req)
+	} else if path == "/data" {
+		dataHandler(w, req)
 	} else {
 		okHandler(w, req)
 	}
 }
 
-func videoHandler(w response.Writer, _ *request.Request) {
-	err := w.WriteStatusLine(response.StatusOK)
-	if err != nil {
-		fmt.Println(err)
+func videoHandler(w *response.Writer, req *request.Request) {
+	fileserver.ServeFile(w, req, "assets/vim.mp4")
+}
+
+func dataHandler(w *response.Writer, req *request.Request) {
+	rep, ok := w.Negotiate(req.Headers, []response.Representation{
+		{ContentType: "application/json"},
+		{ContentType: "text/csv"},
+		{ContentType: "text/html"},
+	})
+	if !ok {
 		return
 	}
 
-	data, err := os.ReadFile("assets/vim.mp4")
+	var body string
+	switch rep.ContentType {
+	case "application/json":
+		body = `[{"name":"vim","size":"small"}]`
+	case "text/csv":
+		body = "name,size\nvim,small\n"
+	default:
+		body = "<table><tr><td>vim</td><td>small</td></tr></table>"
+	}
+	if w.CheckPreconditions(req.Headers, req.RequestLine.Method, response.ETagFromContent([]byte(body)), time.Time{}) {
+		return
+	}
+	err := w.WriteStatusLine(response.StatusOK)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
-
-	h := headers.NewHeaders()
-	h.Set("Content-Type", "video/mp4")
-	h.Set("Cpntent-Lenght", strconv.Itoa(len(data)))
+	h := response.GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", rep.ContentType)
 	err = w.WriteHeaders(h)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
-	_, err = w.WriteBody(data)
+	_, err = w.WriteBody([]byte(body))
 	if err != nil {
-		fmt.Println(err)
-		return
+		w.Logger().Error("handler failed", "err", err)
 	}
-	w.WriteBody([]byte(tools.CRLF))
 }
 
-func proxyHandler(w response.Writer, req *request.Request) {
-	// ctx timeout todo
-	chHttpbin := make(chan []byte)
-	target := fmt.Sprintf(
-		"%s%s",
-		"https://httpbin.org",
-		strings.TrimPrefix(
-			req.RequestLine.RequestTarget,
-			"/httpbin",
-		),
-	)
-	go func() {
-		resp, err := http.Get(target)
+const maxUploadSize = 10 << 20
+
+func uploadHandler(w *response.Writer, req *request.Request) {
+	// Content-Length is gone when the body was sent compressed
+	if cl, err := req.Headers.Get("content-length"); err == nil {
+		n, err := strconv.Atoi(cl)
 		if err != nil {
-			fmt.Println(err)
+			badRequestHandler(w, req)
 			return
 		}
-		defer close(chHttpbin)
-		defer resp.Body.Close()
-		for {
-			b := make([]byte, tools.ChunkSize)
-			n, err := resp.Body.Read(b)
-			if n > 0 {
-				chHttpbin <- b[:n]
-			}
-			if errors.Is(err, io.EOF) {
-				return
-			}
+		if n > maxUploadSize {
+			// Rejected before the body is sent when the client asked for
+			// 100-continue: nothing was read, so no interim response went out.
+			contentTooLargeHandler(w, req)
+			return
 		}
-	}()
+	}
 
-	err := w.WriteStatusLine(response.StatusOK)
+	body, err := req.ReadBody()
+	if errors.Is(err, request.ErrBodyTooLarge) {
+		contentTooLargeHandler(w, req)
+		return
+	}
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
-	h := headers.NewHeaders()
-	h.Set("Content-Type", "application/json")
-	h.Set("Transfer-Encoding", "chunked")
-	h.Set("Trailer", "X-Content-SHA256")
-	h.Set("Trailer", "X-Content-Length")
+	msg := fmt.Sprintf("received %d bytes\n", len(body))
+	err = w.WriteStatusLine(response.StatusOK)
+	if err != nil {
+		w.Logger().Error("handler failed", "err", err)
+		return
+	}
+	h := response.GetDefaultHeaders(len(msg))
+	h.Replace("Content-Type", "text/plain")
 	err = w.WriteHeaders(h)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
-
-	body := []byte{}
-	for chunk := range chHttpbin {
-		body = append(body, chunk...)
-		_, err = w.WriteChunkedBody(chunk)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	_, err = w.WriteBody([]byte(msg))
+	if err != nil {
+		w.Logger().Error("handler failed", "err", err)
 	}
-	_, err = w.WriteChunkedBodyDone()
+}
+
+func contentTooLargeHandler(w *response.Writer, _ *request.Request) {
+	err := w.WriteStatusLine(response.StatusContentTooLarge)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
-
-	sum := sha256.Sum256(body)
-	h.Set("X-Content-SHA256", hex.EncodeToString(sum[:]))
-	h.Set("X-Content-Length", strconv.Itoa(len(body)))
-	err = w.WriteTrailers(h)
+	err = w.WriteHeaders(response.GetDefaultHeaders(0))
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 	}
 }
 
-func badRequestHandler(w response.Writer, _ *request.Request) {
+func badRequestHandler(w *response.Writer, _ *request.Request) {
 	const badRequestHTML = `
 <html>
   <head>
@@ -167,24 +449,24 @@ func badRequestHandler(w response.Writer, _ *request.Request) {
 `
 	err := w.WriteStatusLine(response.StatusBadRequest)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	h := response.GetDefaultHeaders(len(badRequestHTML))
 	err = w.WriteHeaders(h)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	_, err = w.WriteBody([]byte(badRequestHTML))
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	w.WriteBody([]byte(tools.CRLF))
 }
 
-func internalErrorHandler(w response.Writer, _ *request.Request) {
+func internalErrorHandler(w *response.Writer, _ *request.Request) {
 	const internalServerError = `<html>
   <head>
     <title>500 Internal Server Error</title>
@@ -196,24 +478,24 @@ func internalErrorHandler(w response.Writer, _ *request.Request) {
 </html>`
 	err := w.WriteStatusLine(response.StatusInternalServerError)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	h := response.GetDefaultHeaders(len(internalServerError))
 	err = w.WriteHeaders(h)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	_, err = w.WriteBody([]byte(internalServerError))
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	w.WriteBody([]byte(tools.CRLF))
 }
 
-func okHandler(w response.Writer, _ *request.Request) {
+func okHandler(w *response.Writer, _ *request.Request) {
 	const okResponse = `<html>
   <head>
     <title>200 OK</title>
@@ -225,18 +507,18 @@ func okHandler(w response.Writer, _ *request.Request) {
 </html>`
 	err := w.WriteStatusLine(response.StatusOK)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	h := response.GetDefaultHeaders(len(okResponse))
 	err = w.WriteHeaders(h)
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	_, err = w.WriteBody([]byte(okResponse))
 	if err != nil {
-		fmt.Println(err)
+		w.Logger().Error("handler failed", "err", err)
 		return
 	}
 	w.WriteBody([]byte(tools.CRLF))
@@ -0,0 +1,324 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// Request is a request to send with Client.Do.
+type Request struct {
+	Method string
+	URL    *url.URL
+	// Host is sent in the Host header, URL.Host when empty.
+	Host    string
+	Headers headers.Headers
+	Body    io.Reader
+	// ContentLength is the size of Body. -1 sends the body chunked, 0 sends
+	// no body at all.
+	ContentLength int64
+}
+
+// NewRequest returns a request for target. A body of unknown size is sent
+// chunked, set ContentLength when it is known.
+func NewRequest(method, target string, body io.Reader) (*Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported URL: %s", target)
+	}
+	req := &Request{
+		Method:  method,
+		URL:     u,
+		Headers: headers.NewHeaders(),
+		Body:    body,
+	}
+	if body != nil {
+		req.ContentLength = -1
+	}
+	return req, nil
+}
+
+// Client sends requests and keeps the connections open for the next ones
+// to the same host. Its zero value is ready to use.
+type Client struct {
+	// ConnectTimeout bounds the dial and the TLS handshake,
+	// ResponseHeaderTimeout the wait for the status line and the headers
+	// once the request, body included, has been sent.
+	ConnectTimeout        time.Duration
+	ResponseHeaderTimeout time.Duration
+	// TLSConfig is used for https URLs.
+	TLSConfig *tls.Config
+	// Dial opens the connections, a net.Dialer when nil.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// DisableKeepAlives closes every connection after its response.
+	DisableKeepAlives bool
+	// MaxIdleConnsPerHost and IdleTimeout bound the connections kept open,
+	// DefaultMaxIdleConnsPerHost and DefaultIdleTimeout when zero.
+	MaxIdleConnsPerHost int
+	IdleTimeout         time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]*persistConn
+}
+
+var (
+	errNothingRead = errors.New("server closed the connection before answering")
+	// ErrResponseHeaderTimeout is returned by Do once ResponseHeaderTimeout
+	// expired.
+	ErrResponseHeaderTimeout = errors.New("timeout awaiting response headers")
+)
+
+// Do sends req and reads the head of the response, the body is streamed by
+// Body which must be closed. The connection goes back to the pool once the
+// body is read to the end. It is closed when ctx is done, the reads then
+// fail with the cause of ctx.
+//
+// An idle connection may have been closed by the server in the meantime:
+// requests without body and with an idempotent method are then sent again
+// on a new one.
+func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	for {
+		pc, reused, err := c.getConn(ctx, req.URL)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.roundTrip(ctx, pc, req)
+		if err != nil && reused && ctx.Err() == nil && retryable(req, err) {
+			continue
+		}
+		return resp, err
+	}
+}
+
+func (c *Client) getConn(ctx context.Context, u *url.URL) (*persistConn, bool, error) {
+	key := connKey(u)
+	if !c.DisableKeepAlives {
+		for pc := c.popIdle(key); pc != nil; pc = c.popIdle(key) {
+			if pc.alive() {
+				return pc, true, nil
+			}
+			pc.conn.Close()
+		}
+	}
+	conn, err := c.dial(ctx, u)
+	if err != nil {
+		return nil, false, err
+	}
+	return &persistConn{conn: conn, br: bufio.NewReader(conn), key: key}, false, nil
+}
+
+func (c *Client) roundTrip(ctx context.Context, pc *persistConn, req *Request) (*Response, error) {
+	stop := context.AfterFunc(ctx, func() {
+		pc.conn.Close()
+	})
+	fail := func(err error) (*Response, error) {
+		stop()
+		pc.conn.Close()
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(pc.conn)
+	err := req.write(bw, !c.DisableKeepAlives)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	// le délai ne court qu'une fois le body envoyé
+	if c.ResponseHeaderTimeout > 0 {
+		pc.conn.SetReadDeadline(time.Now().Add(c.ResponseHeaderTimeout))
+	}
+	resp, err := ReadResponse(pc.br, req.Method)
+	if errors.Is(err, io.EOF) {
+		err = errNothingRead
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = ErrResponseHeaderTimeout
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if c.ResponseHeaderTimeout > 0 {
+		pc.conn.SetReadDeadline(time.Time{})
+	}
+
+	reusable := !c.DisableKeepAlives && !resp.close
+	resp.Body = &body{
+		ctx:   ctx,
+		r:     resp.Body,
+		empty: resp.ContentLength == 0,
+		release: func(drained bool) {
+			if stop() && drained && reusable {
+				c.putIdle(pc)
+				return
+			}
+			pc.conn.Close()
+		},
+	}
+	return resp, nil
+}
+
+func (c *Client) dial(ctx context.Context, u *url.URL) (net.Conn, error) {
+	addr := hostPort(u)
+	if c.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ConnectTimeout)
+		defer cancel()
+	}
+
+	dial := c.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+	cfg := &tls.Config{}
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+	tlsConn := tls.Client(conn, cfg)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// write sends the request line, the headers and the body, with the framing
+// rules of response.Writer: Content-Length when the size is known, chunks
+// otherwise.
+func (req *Request) write(w io.Writer, keepAlive bool) error {
+	target := req.URL.RequestURI()
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if strings.ContainsAny(req.Method+target+host, " \r\n") {
+		return errors.New("invalid request line")
+	}
+	_, err := fmt.Fprintf(w, "%s %s HTTP/1.1%sHost: %s%s", req.Method, target, tools.CRLF, host, tools.CRLF)
+	if err != nil {
+		return err
+	}
+
+	h := headers.NewHeaders()
+	for k, v := range req.Headers {
+		switch strings.ToLower(k) {
+		case "host", "content-length", "transfer-encoding", "connection":
+			continue
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid value for %s", k)
+		}
+		h[k] = v
+	}
+	if !keepAlive {
+		h["Connection"] = "close"
+	}
+	switch {
+	case req.Body == nil || req.ContentLength == 0:
+		if req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH" {
+			h["Content-Length"] = "0"
+		}
+	case req.ContentLength > 0:
+		h["Content-Length"] = strconv.FormatInt(req.ContentLength, 10)
+	default:
+		h["Transfer-Encoding"] = "chunked"
+	}
+	b := []byte{}
+	for k, v := range h {
+		b = fmt.Appendf(b, "%s: %s%s", k, v, tools.CRLF)
+	}
+	_, err = w.Write(append(b, tools.CRLF...))
+	if err != nil || req.Body == nil || req.ContentLength == 0 {
+		return err
+	}
+
+	if req.ContentLength > 0 {
+		n, err := io.CopyN(w, req.Body, req.ContentLength)
+		if err != nil && n < req.ContentLength {
+			return fmt.Errorf("body shorter than its content-length: %w", err)
+		}
+		return nil
+	}
+	buf := make([]byte, tools.ChunkSize)
+	for {
+		n, err := req.Body.Read(buf)
+		if n > 0 {
+			_, werr := fmt.Fprintf(w, "%X%s%s%s", n, tools.CRLF, buf[:n], tools.CRLF)
+			if werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "0%s%s", tools.CRLF, tools.CRLF)
+	return err
+}
+
+// body hands the connection back once the response has been read, its
+// errors become the cause of ctx once it is done.
+type body struct {
+	ctx context.Context
+	r   io.Reader
+	// empty bodies can be closed without being read
+	empty   bool
+	release func(drained bool)
+	once    sync.Once
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	switch {
+	case errors.Is(err, io.EOF):
+		b.once.Do(func() { b.release(true) })
+	case err != nil:
+		if b.ctx.Err() != nil {
+			err = context.Cause(b.ctx)
+		}
+		b.once.Do(func() { b.release(false) })
+	}
+	return n, err
+}
+
+// Close gives the connection back when the body was read to the end, and
+// closes it otherwise.
+func (b *body) Close() error {
+	b.once.Do(func() { b.release(b.empty) })
+	return nil
+}
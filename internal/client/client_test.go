@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoServer(t *testing.T) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(echo))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("X-Method", r.Method)
+	w.Header().Set("X-Host", r.Host)
+	w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+	w.Header().Set("X-Test", r.Header.Get("X-Test"))
+	io.WriteString(w, r.RequestURI+" "+string(body))
+}
+
+func do(t *testing.T, c *Client, req *Request) (*Response, string) {
+	resp, err := c.Do(context.Background(), req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestClientDo(t *testing.T) {
+	s := echoServer(t)
+	c := &Client{}
+
+	// Test: GET with headers and query
+	req, err := NewRequest("GET", s.URL+"/path?q=1", nil)
+	require.NoError(t, err)
+	req.Headers.Set("X-Test", "yes")
+	resp, body := do(t, c, req)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "/path?q=1 ", body)
+	v, _ := resp.Headers.Get("X-Test")
+	assert.Equal(t, "yes", v)
+	v, _ = resp.Headers.Get("X-Host")
+	assert.Equal(t, strings.TrimPrefix(s.URL, "http://"), v)
+
+	// Test: Body with a known length
+	req, err = NewRequest("POST", s.URL+"/", strings.NewReader("hello"))
+	require.NoError(t, err)
+	req.ContentLength = 5
+	req.Host = "example.com"
+	resp, body = do(t, c, req)
+	assert.Equal(t, "/ hello", body)
+	v, _ = resp.Headers.Get("X-Host")
+	assert.Equal(t, "example.com", v)
+	v, _ = resp.Headers.Get("X-Transfer-Encoding")
+	assert.Equal(t, "", v)
+
+	// Test: Body of unknown length is chunked
+	req, err = NewRequest("PUT", s.URL+"/", io.MultiReader(
+		strings.NewReader("one "), strings.NewReader(strings.Repeat("x", 3000)),
+	))
+	require.NoError(t, err)
+	resp, body = do(t, c, req)
+	assert.Equal(t, "/ one "+strings.Repeat("x", 3000), body)
+	v, _ = resp.Headers.Get("X-Transfer-Encoding")
+	assert.Equal(t, "chunked", v)
+
+	// Test: Invalid URLs
+	for _, target := range []string{"ftp://example.com", "/relative"} {
+		_, err = NewRequest("GET", target, nil)
+		assert.Error(t, err, target)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(echo))
+	defer s.Close()
+
+	// Test: The certificate is checked
+	req, err := NewRequest("GET", s.URL+"/secure", nil)
+	require.NoError(t, err)
+	_, err = (&Client{}).Do(context.Background(), req)
+	assert.Error(t, err)
+
+	// Test: Trusted with the server pool
+	c := &Client{TLSConfig: s.Client().Transport.(*http.Transport).TLSClientConfig}
+	resp, body := do(t, c, req)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "/secure ", body)
+
+	c = &Client{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+	resp, _ = do(t, c, req)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestClientCancel(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "start")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer s.Close()
+	defer close(release)
+
+	// Test: Cancelling the context cuts the body with its cause
+	cause := errors.New("gave up")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	req, err := NewRequest("GET", s.URL, nil)
+	require.NoError(t, err)
+	resp, err := (&Client{}).Do(ctx, req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(resp.Body, buf)
+	require.NoError(t, err)
+	time.AfterFunc(10*time.Millisecond, func() { cancel(cause) })
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, cause)
+
+	// Test: Already cancelled
+	_, err = (&Client{}).Do(ctx, req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxIdleConnsPerHost = 2
+	DefaultIdleTimeout         = 90 * time.Second
+)
+
+// aLongTimeAgo is a read deadline in the past, to interrupt a blocked read.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// persistConn is a connection kept open between requests.
+type persistConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	key  string
+
+	// while idle, a Peek watches for the server closing the connection, its
+	// result comes on peeked once the deadline interrupts it
+	peeked chan error
+	timer  *time.Timer
+}
+
+// connKey groups the connections by scheme and address.
+func connKey(u *url.URL) string {
+	return u.Scheme + "://" + hostPort(u)
+}
+
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// popIdle takes the most recent idle connection to key, nil when none.
+func (c *Client) popIdle(key string) *persistConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conns := c.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	pc := conns[len(conns)-1]
+	c.idle[key] = conns[:len(conns)-1]
+	pc.timer.Stop()
+	return pc
+}
+
+// alive stops the watch of an idle connection and reports whether the
+// server kept it open: the Peek must end on the deadline, not on EOF nor
+// on unexpected data.
+func (pc *persistConn) alive() bool {
+	pc.conn.SetReadDeadline(aLongTimeAgo)
+	err := <-pc.peeked
+	pc.conn.SetReadDeadline(time.Time{})
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// putIdle keeps pc for a later request to the same host, or closes it when
+// there are enough idle connections already.
+func (c *Client) putIdle(pc *persistConn) {
+	maxIdle := c.MaxIdleConnsPerHost
+	if maxIdle == 0 {
+		maxIdle = DefaultMaxIdleConnsPerHost
+	}
+	timeout := c.IdleTimeout
+	if timeout == 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.idle == nil {
+		c.idle = map[string][]*persistConn{}
+	}
+	if len(c.idle[pc.key]) >= maxIdle {
+		pc.conn.Close()
+		return
+	}
+	c.idle[pc.key] = append(c.idle[pc.key], pc)
+
+	pc.peeked = make(chan error, 1)
+	go func() {
+		_, err := pc.br.Peek(1)
+		pc.peeked <- err
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			c.removeIdle(pc)
+		}
+	}()
+	pc.timer = time.AfterFunc(timeout, func() {
+		c.removeIdle(pc)
+	})
+}
+
+// removeIdle closes pc if it is still idle, a request may have taken it
+// meanwhile.
+func (c *Client) removeIdle(pc *persistConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conns := c.idle[pc.key]
+	i := slices.Index(conns, pc)
+	if i == -1 {
+		return
+	}
+	c.idle[pc.key] = slices.Delete(conns, i, i+1)
+	pc.timer.Stop()
+	pc.conn.Close()
+}
+
+// CloseIdleConnections closes the connections kept for reuse.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conns := range c.idle {
+		for _, pc := range conns {
+			pc.timer.Stop()
+			pc.conn.Close()
+		}
+	}
+	c.idle = nil
+}
+
+// retryable reports whether req can be sent again after err on a reused
+// connection: the server closed it before answering anything, and sending
+// the request twice is harmless.
+func retryable(req *Request, err error) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+	default:
+		return false
+	}
+	if req.Body != nil && req.ContentLength != 0 {
+		// le body a pu être consommé, on ne sait pas le relire
+		return false
+	}
+	return errors.Is(err, errNothingRead) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
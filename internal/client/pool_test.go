@@ -0,0 +1,167 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingServer is an echoServer counting the connections it accepted.
+func countingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	conns := &atomic.Int32{}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(echo))
+	s.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s, conns
+}
+
+func get(t *testing.T, c *Client, target string) string {
+	req, err := NewRequest("GET", target, nil)
+	require.NoError(t, err)
+	_, body := do(t, c, req)
+	return body
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	s, conns := countingServer(t)
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	// Test: Sequential requests share one connection
+	for range 5 {
+		assert.Equal(t, "/ ", get(t, c, s.URL+"/"))
+	}
+	req, err := NewRequest("POST", s.URL+"/", strings.NewReader("hello"))
+	require.NoError(t, err)
+	_, body := do(t, c, req)
+	assert.Equal(t, "/ hello", body)
+	assert.EqualValues(t, 1, conns.Load())
+
+	// Test: A body closed before its end loses the connection
+	req, err = NewRequest("GET", s.URL+"/", nil)
+	require.NoError(t, err)
+	resp, err := c.Do(t.Context(), req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	get(t, c, s.URL+"/")
+	assert.EqualValues(t, 2, conns.Load())
+
+	// Test: DisableKeepAlives
+	c.CloseIdleConnections()
+	c.DisableKeepAlives = true
+	get(t, c, s.URL+"/")
+	get(t, c, s.URL+"/")
+	assert.EqualValues(t, 4, conns.Load())
+}
+
+func TestClientIdleLimits(t *testing.T) {
+	s, conns := countingServer(t)
+	c := &Client{MaxIdleConnsPerHost: 1, IdleTimeout: 50 * time.Millisecond}
+	defer c.CloseIdleConnections()
+
+	// Test: Only MaxIdleConnsPerHost connections are kept
+	bodies := []*Response{}
+	for range 3 {
+		req, err := NewRequest("GET", s.URL+"/", nil)
+		require.NoError(t, err)
+		resp, err := c.Do(t.Context(), req)
+		require.NoError(t, err)
+		bodies = append(bodies, resp)
+	}
+	for _, resp := range bodies {
+		_, err := resp.Body.Read(make([]byte, 64))
+		for err == nil {
+			_, err = resp.Body.Read(make([]byte, 64))
+		}
+		resp.Body.Close()
+	}
+	assert.EqualValues(t, 3, conns.Load())
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	c.mu.Lock()
+	assert.Len(t, c.idle[connKey(u)], 1)
+	c.mu.Unlock()
+	get(t, c, s.URL+"/")
+	assert.EqualValues(t, 3, conns.Load())
+
+	// Test: Idle connections expire after IdleTimeout
+	time.Sleep(100 * time.Millisecond)
+	get(t, c, s.URL+"/")
+	assert.EqualValues(t, 4, conns.Load())
+}
+
+func TestClientStaleConnection(t *testing.T) {
+	s, conns := countingServer(t)
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	// Test: A connection closed by the server while idle isn't reused
+	get(t, c, s.URL+"/")
+	s.CloseClientConnections()
+	assert.Equal(t, "/ ", get(t, c, s.URL+"/"))
+	assert.EqualValues(t, 2, conns.Load())
+}
+
+// oneShotServer answers the first request of each connection, and closes it
+// without answering when a second one comes.
+func oneShotServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for i := 0; ; i++ {
+					req, err := http.ReadRequest(br)
+					if err != nil {
+						return
+					}
+					io.Copy(io.Discard, req.Body)
+					if i > 0 {
+						return
+					}
+					io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+	return "http://" + l.Addr().String()
+}
+
+func TestClientRetry(t *testing.T) {
+	target := oneShotServer(t)
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	// Test: An idempotent request is sent again on a new connection
+	assert.Equal(t, "ok", get(t, c, target+"/"))
+	assert.Equal(t, "ok", get(t, c, target+"/"))
+
+	// Test: A POST is not
+	req, err := NewRequest("POST", target+"/", strings.NewReader("x"))
+	require.NoError(t, err)
+	_, err = c.Do(t.Context(), req)
+	assert.True(t, errors.Is(err, errNothingRead) || errors.Is(err, io.ErrUnexpectedEOF), err)
+}
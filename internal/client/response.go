@@ -0,0 +1,292 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// maxHeadSize bounds the status line and the headers of a response, and the
+// trailers of a chunked body.
+const maxHeadSize = 1 << 20
+
+var ErrHeadTooLarge = errors.New("response head too large")
+
+type Response struct {
+	StatusCode int
+	// Status is the reason phrase, it may be empty.
+	Status  string
+	Headers headers.Headers
+	// SetCookies holds the Set-Cookie values apart: they can't be combined
+	// on one line like the other fields.
+	SetCookies []string
+	// Trailers is filled once a chunked Body has been read to the end.
+	Trailers headers.Headers
+	// ContentLength is -1 when the body is chunked or delimited by the end of
+	// the connection.
+	ContentLength int64
+	Body          io.ReadCloser
+
+	// close is set when the connection can't carry another request.
+	close bool
+}
+
+// ReadResponse parses a response from br, the response-side counterpart of
+// request.ReadRequest: the status line and the headers are read, the body
+// is streamed by Body. method is the one of the request, a response to HEAD
+// has no body. Interim 1xx responses are skipped.
+func ReadResponse(br *bufio.Reader, method string) (*Response, error) {
+	for {
+		resp, err := readHead(br)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 || resp.StatusCode == 101 {
+			err = resp.setupBody(br, method)
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+}
+
+func readHead(br *bufio.Reader) (*Response, error) {
+	read := 0
+	line, err := readLine(br, &read)
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{Headers: headers.NewHeaders()}
+	var proto string
+	proto, resp.StatusCode, resp.Status, err = parseStatusLine(line)
+	if err != nil {
+		return nil, err
+	}
+	err = readFields(br, &read, resp.Headers, &resp.SetCookies)
+	if err != nil {
+		return nil, err
+	}
+
+	// HTTP/1.0 ferme par défaut, HTTP/1.1 garde la connexion
+	resp.close = proto == "HTTP/1.0"
+	if v, err := resp.Headers.Get("connection"); err == nil {
+		for _, opt := range headers.SplitList(v) {
+			switch strings.ToLower(opt) {
+			case "close":
+				resp.close = true
+			case "keep-alive":
+				resp.close = false
+			}
+		}
+	}
+	return resp, nil
+}
+
+func parseStatusLine(line string) (string, int, string, error) {
+	proto, rest, ok := strings.Cut(line, " ")
+	if !ok || !strings.HasPrefix(proto, "HTTP/1.") {
+		return "", 0, "", fmt.Errorf("bad status-line format: %s", line)
+	}
+	code, reason, _ := strings.Cut(rest, " ")
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || len(code) != 3 || statusCode < 100 {
+		return "", 0, "", fmt.Errorf("invalid status code: %s", code)
+	}
+	return proto, statusCode, reason, nil
+}
+
+// readLine reads a line without its CRLF, read counts the bytes of the head
+// so far.
+func readLine(br *bufio.Reader, read *int) (string, error) {
+	line := []byte{}
+	for {
+		part, err := br.ReadSlice('\n')
+		*read += len(part)
+		if *read > maxHeadSize {
+			return "", ErrHeadTooLarge
+		}
+		line = append(line, part...)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			if errors.Is(err, io.EOF) && *read > 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// readFields reads header or trailer fields up to the empty line. The
+// Set-Cookie ones go to cookies when it isn't nil.
+func readFields(br *bufio.Reader, read *int, h headers.Headers, cookies *[]string) error {
+	for {
+		line, err := readLine(br, read)
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+		if key, v, ok := strings.Cut(line, ":"); ok && cookies != nil &&
+			strings.EqualFold(key, "set-cookie") {
+			*cookies = append(*cookies, strings.TrimSpace(v))
+			continue
+		}
+		_, _, err = h.Parse([]byte(line + tools.CRLF))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// setupBody picks the framing of the body (RFC 9112 §6.3).
+func (resp *Response) setupBody(br *bufio.Reader, method string) error {
+	if method == "HEAD" || resp.StatusCode == 204 || resp.StatusCode == 304 {
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		return nil
+	}
+	if te, err := resp.Headers.Get("transfer-encoding"); err == nil {
+		codings := headers.SplitList(te)
+		resp.ContentLength = -1
+		if len(codings) > 0 && strings.EqualFold(codings[len(codings)-1], "chunked") {
+			resp.Body = io.NopCloser(&chunkedReader{br: br, resp: resp})
+		} else {
+			resp.close = true
+			resp.Body = io.NopCloser(br)
+		}
+		return nil
+	}
+	if cl, err := resp.Headers.Get("content-length"); err == nil {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid content-length: %s", cl)
+		}
+		resp.ContentLength = n
+		resp.Body = io.NopCloser(&lengthReader{r: br, remaining: n})
+		return nil
+	}
+	// sans longueur, le body va jusqu'à la fermeture de la connexion
+	resp.close = true
+	resp.ContentLength = -1
+	resp.Body = io.NopCloser(br)
+	return nil
+}
+
+// lengthReader reads a body delimited by Content-Length.
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if errors.Is(err, io.EOF) && l.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// chunkedReader decodes a chunked body and reads its trailers into
+// resp.Trailers.
+type chunkedReader struct {
+	br        *bufio.Reader
+	resp      *Response
+	remaining int64
+	done      bool
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		err := c.nextChunk()
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		err = c.readCRLF()
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *chunkedReader) nextChunk() error {
+	read := 0
+	line, err := readLine(c.br, &read)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	// les extensions après ';' sont ignorées
+	size, _, _ := strings.Cut(line, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid chunk size: %s", line)
+	}
+	if n > 0 {
+		c.remaining = n
+		return nil
+	}
+	c.done = true
+	trailers := headers.NewHeaders()
+	err = readFields(c.br, &read, trailers, nil)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	c.resp.Trailers = trailers
+	return nil
+}
+
+func (c *chunkedReader) readCRLF() error {
+	b := make([]byte, 2)
+	_, err := io.ReadFull(c.br, b)
+	if err != nil {
+		return err
+	}
+	if string(b) != tools.CRLF {
+		return errors.New("missing CRLF after chunk data")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readString(t *testing.T, raw, method string) (*Response, string, error) {
+	resp, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)), method)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	return resp, string(body), err
+}
+
+func TestReadResponse(t *testing.T) {
+	// Test: Content-Length body
+	resp, body, err := readString(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 5\r\n"+
+		"Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"\r\nhello, and more", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "OK", resp.Status)
+	assert.Equal(t, int64(5), resp.ContentLength)
+	assert.Equal(t, "hello", body)
+	v, err := resp.Headers.Get("Content-Type")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", v)
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, resp.SetCookies)
+
+	// Test: Values with ':' next to spaces are kept as is
+	resp, _, err = readString(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Security-Policy: script-src 'self' https: 'unsafe-inline'\r\n"+
+		"Location:  http://example.com:8080/a?b=c \r\n"+
+		"Vary: Accept\r\nVary: Accept-Encoding\r\n"+
+		"Content-Length: 0\r\n\r\n", "GET")
+	require.NoError(t, err)
+	v, err = resp.Headers.Get("Content-Security-Policy")
+	require.NoError(t, err)
+	assert.Equal(t, "script-src 'self' https: 'unsafe-inline'", v)
+	v, err = resp.Headers.Get("Location")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com:8080/a?b=c", v)
+	v, err = resp.Headers.Get("Vary")
+	require.NoError(t, err)
+	assert.Equal(t, "Accept, Accept-Encoding", v)
+
+	// Test: Chunked body with extensions and trailers
+	resp, body, err = readString(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Checksum\r\n"+
+		"\r\n"+
+		"5;name=value\r\nhello\r\n"+
+		"7\r\n, world\r\n"+
+		"0\r\n"+
+		"X-Checksum: abc\r\n"+
+		"\r\n", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.Equal(t, "hello, world", body)
+	v, err = resp.Trailers.Get("X-Checksum")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", v)
+
+	// Test: Close-delimited body
+	resp, body, err = readString(t, "HTTP/1.0 200 OK\r\n\r\nuntil the end", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.Equal(t, "until the end", body)
+
+	// Test: No body for HEAD, 204 and 304
+	_, body, err = readString(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "", body)
+	resp, body, err = readString(t, "HTTP/1.1 304 Not Modified\r\nETag: \"x\"\r\n\r\n", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, 304, resp.StatusCode)
+	assert.Equal(t, "", body)
+
+	// Test: Interim responses are skipped, an empty reason is fine
+	resp, body, err = readString(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n"+
+		"HTTP/1.1 201\r\nContent-Length: 2\r\n\r\nok", "POST")
+	require.NoError(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+	assert.Equal(t, "", resp.Status)
+	assert.Equal(t, "ok", body)
+
+	// Test: Truncated bodies
+	_, _, err = readString(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, _, err = readString(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, _, err = readString(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", "GET")
+	assert.Error(t, err)
+}
+
+func TestReadResponseErrors(t *testing.T) {
+	for _, raw := range []string{
+		"HTTP/2 200 OK\r\n\r\n",
+		"HTTP/1.1 2000 OK\r\n\r\n",
+		"HTTP/1.1 abc OK\r\n\r\n",
+		"garbage\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nno colon\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Type : text/plain\r\n\r\n",
+		"HTTP/1.1 200 OK\r\n: empty name\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n",
+	} {
+		_, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)), "GET")
+		assert.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,140 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+var ErrNoCookie = errors.New("cookie not found")
+
+// Cookie is a name/value pair from a Cookie header, or a cookie to send
+// with Set-Cookie along with its attributes.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge = 0 omits the attribute, MaxAge < 0 deletes the cookie now
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse reads the pairs of a Cookie header. Pairs with an invalid name are
+// skipped, surrounding quotes are removed from the values.
+func Parse(header string) []*Cookie {
+	cookies := []*Cookie{}
+	for pair := range strings.SplitSeq(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !validName(name) {
+			continue
+		}
+		if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if !validValue(value) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// Valid reports why the cookie can't be sent in a Set-Cookie header.
+func (c *Cookie) Valid() error {
+	if !validName(c.Name) {
+		return fmt.Errorf("invalid cookie name: %q", c.Name)
+	}
+	if !validValue(c.Value) {
+		return fmt.Errorf("invalid cookie value: %q", c.Value)
+	}
+	if strings.ContainsAny(c.Path+c.Domain, ";\r\n") {
+		return fmt.Errorf("invalid path or domain for cookie %s", c.Name)
+	}
+	if (c.Partitioned || c.SameSite == SameSiteNone) && !c.Secure {
+		return fmt.Errorf(
+			"cookie %s: Partitioned and SameSite=None need Secure", c.Name,
+		)
+	}
+	return nil
+}
+
+// String formats the cookie as the value of a Set-Cookie header.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name + "=" + c.Value)
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(tools.TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 127 || tools.IsForbiddenChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validValue checks for cookie-octets: visible ASCII without '"', ',', ';'
+// and '\'.
+func validValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Standard Cookie header
+	cookies := Parse("session=abc123; theme=dark;lang=\"fr\"")
+	require.Equal(t, 3, len(cookies))
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc123", cookies[0].Value)
+	assert.Equal(t, "theme", cookies[1].Name)
+	assert.Equal(t, "dark", cookies[1].Value)
+	assert.Equal(t, "fr", cookies[2].Value)
+
+	// Test: Empty value
+	cookies = Parse("empty=")
+	require.Equal(t, 1, len(cookies))
+	assert.Equal(t, "", cookies[0].Value)
+
+	// Test: Invalid pairs are skipped
+	cookies = Parse("noequal; b@d=1; ok=1; sp=a b")
+	require.Equal(t, 1, len(cookies))
+	assert.Equal(t, "ok", cookies[0].Name)
+}
+
+func TestString(t *testing.T) {
+	// Test: Name and value only
+	c := &Cookie{Name: "id", Value: "42"}
+	assert.Equal(t, "id=42", c.String())
+
+	// Test: Every attribute
+	c = &Cookie{
+		Name:        "session",
+		Value:       "abc",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(
+		t,
+		"session=abc; Path=/; Domain=example.com; "+
+			"Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=3600; "+
+			"Secure; HttpOnly; SameSite=None; Partitioned",
+		c.String(),
+	)
+
+	// Test: Deletion
+	c = &Cookie{Name: "session", MaxAge: -1, SameSite: SameSiteLax}
+	assert.Equal(t, "session=; Max-Age=0; SameSite=Lax", c.String())
+}
+
+func TestValid(t *testing.T) {
+	assert.Error(t, (&Cookie{Name: "", Value: "a"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a b", Value: "a"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Value: "x;y"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Path: "/\r\nX: y"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Partitioned: true}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", SameSite: SameSiteNone}).Valid())
+	assert.NoError(t, (&Cookie{Name: "a", Value: "b", Path: "/"}).Valid())
+}
@@ -0,0 +1,245 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// maxRanges is the number of ranges above which the Range header is ignored,
+// many small ranges cost more than the whole content.
+const maxRanges = 32
+
+// span is a resolved range of the content.
+type span struct {
+	start  int64
+	length int64
+}
+
+func (s span) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", s.start, s.start+s.length-1, size)
+}
+
+// ServeContent answers req with content, honoring Range: one range is sent
+// as a 206 with Content-Range, several as multipart/byteranges, and ranges
+// outside of the content get a 416. If-Range falls back to the whole content
+// when the validators show it changed. name is only used to guess the type.
+//
+// The conditional requests are answered with a 304 or a 412 against modtime
+// and the ETag of w.Header(), made from the size and modtime when the
+// handler didn't set one.
+func ServeContent(w *response.Writer, req *request.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		writeError(w, response.StatusInternalServerError)
+		return
+	}
+	etag := currentETag(w, size, modtime)
+	if w.CheckPreconditions(req.Headers, req.RequestLine.Method, etag, modtime) {
+		return
+	}
+	ctype, err := detectType(name, content)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		writeError(w, response.StatusInternalServerError)
+		return
+	}
+
+	h := response.GetDefaultHeaders(0)
+	h.Replace("Content-Type", ctype)
+	h.Set("Accept-Ranges", "bytes")
+
+	spans, satisfiable := requestedSpans(req, size, etag, modtime)
+	switch {
+	case !satisfiable:
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		err = w.WriteStatusLine(response.StatusRangeNotSatisfiable)
+		if err == nil {
+			err = w.WriteHeaders(h)
+		}
+	case len(spans) == 0:
+		h.Replace("Content-Length", strconv.FormatInt(size, 10))
+		err = writeSpan(w, req, response.StatusOK, h, content, span{0, size})
+	case len(spans) == 1:
+		h.Replace("Content-Length", strconv.FormatInt(spans[0].length, 10))
+		h.Set("Content-Range", spans[0].contentRange(size))
+		err = writeSpan(w, req, response.StatusPartialContent, h, content, spans[0])
+	default:
+		err = writeMultipart(w, req, h, content, ctype, size, spans)
+	}
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+	}
+}
+
+// detectType guesses the type from name, or from the first bytes of content.
+// content is left at its start.
+func detectType(name string, content io.ReadSeeker) (string, error) {
+	_, err := content.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	return contentType(name, head[:n]), err
+}
+
+// requestedSpans resolves the Range of req against size. No spans means the
+// whole content: no Range, a malformed one, a failed If-Range or too many
+// ranges. It isn't satisfiable when every range starts after the end.
+func requestedSpans(req *request.Request, size int64, etag headers.ETag, modtime time.Time) ([]span, bool) {
+	if req.RequestLine.Method != request.GET && req.RequestLine.Method != request.HEAD {
+		return nil, true
+	}
+	ranges, ok := req.Headers.Range()
+	if !ok || len(ranges) > maxRanges {
+		return nil, true
+	}
+	if ifRange, err := req.Headers.Get("if-range"); err == nil {
+		if !ifRangeMatches(ifRange, etag, modtime) {
+			return nil, true
+		}
+	}
+
+	spans := []span{}
+	for _, r := range ranges {
+		var s span
+		switch {
+		case r.Start == -1:
+			// les N derniers octets
+			if r.End == 0 {
+				continue
+			}
+			s.start = max(size-r.End, 0)
+			s.length = size - s.start
+		case r.Start >= size:
+			continue
+		case r.End == -1 || r.End >= size:
+			s.start = r.Start
+			s.length = size - r.Start
+		default:
+			s.start = r.Start
+			s.length = r.End - r.Start + 1
+		}
+		spans = append(spans, s)
+	}
+	if len(spans) == 0 {
+		return nil, false
+	}
+	return spans, true
+}
+
+// ifRangeMatches only accepts strong validators: the same strong ETag, or a
+// date equal to modtime.
+func ifRangeMatches(ifRange string, etag headers.ETag, modtime time.Time) bool {
+	if tag, ok := headers.ParseETag(ifRange); ok {
+		return !tag.Weak && !etag.Weak && etag.Value != "" && tag.Value == etag.Value
+	}
+	t, ok := headers.ParseTime(ifRange)
+	if !ok || modtime.IsZero() {
+		return false
+	}
+	return t.Equal(modtime.UTC().Truncate(time.Second))
+}
+
+// currentETag is the ETag the handler set, or one from size and
+// modtime. Content without modtime has none.
+func currentETag(w *response.Writer, size int64, modtime time.Time) headers.ETag {
+	if v, err := w.Header().Get("etag"); err == nil {
+		if tag, ok := headers.ParseETag(v); ok {
+			return tag
+		}
+	}
+	if modtime.IsZero() {
+		return headers.ETag{}
+	}
+	return response.ETagFromFileInfo(size, modtime)
+}
+
+func writeSpan(w *response.Writer, req *request.Request, statusCode tools.StatusCode, h headers.Headers, content io.ReadSeeker, s span) error {
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+	if req.RequestLine.Method == request.HEAD {
+		return nil
+	}
+	_, err = content.Seek(s.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteBodyFrom(io.LimitReader(content, s.length))
+	return err
+}
+
+func writeMultipart(w *response.Writer, req *request.Request, h headers.Headers, content io.ReadSeeker, ctype string, size int64, spans []span) error {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	boundary := hex.EncodeToString(b)
+
+	// les en-têtes de chaque partie sont connus d'avance, ce qui donne la
+	// taille exacte du body
+	partHeaders := make([]string, len(spans))
+	total := int64(0)
+	for i, s := range spans {
+		partHeaders[i] = fmt.Sprintf(
+			"\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n",
+			boundary, ctype, s.contentRange(size),
+		)
+		total += int64(len(partHeaders[i])) + s.length
+	}
+	closing := "\r\n--" + boundary + "--\r\n"
+	total += int64(len(closing))
+
+	h.Replace("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Replace("Content-Length", strconv.FormatInt(total, 10))
+	err = w.WriteStatusLine(response.StatusPartialContent)
+	if err != nil {
+		return err
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+	if req.RequestLine.Method == request.HEAD {
+		return nil
+	}
+
+	for i, s := range spans {
+		_, err = w.WriteBody([]byte(partHeaders[i]))
+		if err != nil {
+			return err
+		}
+		_, err = content.Seek(s.start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = w.WriteBodyFrom(io.LimitReader(content, s.length))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.WriteBody([]byte(closing))
+	return err
+}
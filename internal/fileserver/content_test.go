@@ -0,0 +1,138 @@
+package fileserver
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+var modtime = time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+
+func serveDigits(w *response.Writer, req *request.Request) {
+	ServeContent(w, req, "digits.txt", modtime, strings.NewReader(digits))
+}
+
+func TestServeContentRanges(t *testing.T) {
+	// Test: No Range
+	resp, body := serve(t, serveDigits, "GET", "/")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	assert.Equal(t, digits, body)
+
+	// Test: Single ranges
+	for rng, want := range map[string]string{
+		"bytes=0-4":    "01234",
+		"bytes=30-":    "uvwxyz",
+		"bytes=-3":     "xyz",
+		"bytes=34-100": "yz",
+		"bytes=-100":   digits,
+	} {
+		resp, body = serve(t, serveDigits, "GET", "/", "Range: "+rng+"\r\n")
+		assert.Equal(t, 206, resp.StatusCode, rng)
+		assert.Equal(t, want, body, rng)
+	}
+	resp, _ = serve(t, serveDigits, "GET", "/", "Range: bytes=10-19\r\n")
+	assert.Equal(t, "bytes 10-19/36", resp.Header.Get("Content-Range"))
+	assert.Equal(t, int64(10), resp.ContentLength)
+
+	// Test: Multiple ranges
+	resp, body = serve(t, serveDigits, "GET", "/", "Range: bytes=0-1, 34-, 99-\r\n")
+	assert.Equal(t, 206, resp.StatusCode)
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	parts := map[string]string{}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", p.Header.Get("Content-Type"))
+		data, err := io.ReadAll(p)
+		require.NoError(t, err)
+		parts[p.Header.Get("Content-Range")] = string(data)
+	}
+	assert.Equal(t, map[string]string{
+		"bytes 0-1/36":   "01",
+		"bytes 34-35/36": "yz",
+	}, parts)
+
+	// Test: Unsatisfiable
+	resp, body = serve(t, serveDigits, "GET", "/", "Range: bytes=36-, -0\r\n")
+	assert.Equal(t, 416, resp.StatusCode)
+	assert.Equal(t, "bytes */36", resp.Header.Get("Content-Range"))
+	assert.Equal(t, "", body)
+
+	// Test: Malformed or other units are ignored
+	for _, rng := range []string{"bytes=5-1", "lines=1-2", "bytes=x"} {
+		resp, body = serve(t, serveDigits, "GET", "/", "Range: "+rng+"\r\n")
+		assert.Equal(t, 200, resp.StatusCode, rng)
+		assert.Equal(t, digits, body, rng)
+	}
+
+	// Test: If-Range
+	resp, body = serve(t, serveDigits, "GET", "/",
+		"Range: bytes=0-1\r\n", "If-Range: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.Equal(t, 206, resp.StatusCode)
+	assert.Equal(t, "01", body)
+	resp, body = serve(t, serveDigits, "GET", "/",
+		"Range: bytes=0-1\r\n", "If-Range: Thu, 29 Feb 2024 12:00:00 GMT\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, digits, body)
+
+	// Test: HEAD with a range
+	resp, body = serve(t, serveDigits, "HEAD", "/", "Range: bytes=0-4\r\n")
+	assert.Equal(t, 206, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "", body)
+}
+
+func TestServeContentConditional(t *testing.T) {
+	// Test: Validators are sent
+	resp, _ := serve(t, serveDigits, "GET", "/")
+	etag := resp.Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `"`), etag)
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	// Test: Revalidation
+	resp, body := serve(t, serveDigits, "GET", "/", "If-None-Match: "+etag+"\r\n")
+	assert.Equal(t, 304, resp.StatusCode)
+	assert.Equal(t, "", body)
+	resp, _ = serve(t, serveDigits, "HEAD", "/", "If-Modified-Since: Sat, 02 Mar 2024 00:00:00 GMT\r\n")
+	assert.Equal(t, 304, resp.StatusCode)
+	resp, _ = serve(t, serveDigits, "GET", "/", "If-Unmodified-Since: Thu, 29 Feb 2024 00:00:00 GMT\r\n")
+	assert.Equal(t, 412, resp.StatusCode)
+
+	// Test: A strong ETag set by the handler, usable by If-Range
+	strong := func(w *response.Writer, req *request.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		serveDigits(w, req)
+	}
+	resp, body = serve(t, strong, "GET", "/", "Range: bytes=0-1\r\n", "If-Range: \"v1\"\r\n")
+	assert.Equal(t, 206, resp.StatusCode)
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "01", body)
+	resp, _ = serve(t, strong, "GET", "/", "Range: bytes=0-1\r\n", "If-Range: \"v0\"\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// Test: The default ETag is strong, If-Range resumes with it
+	resp, body = serve(t, serveDigits, "GET", "/", "Range: bytes=0-1\r\n", "If-Range: "+etag+"\r\n")
+	assert.Equal(t, 206, resp.StatusCode)
+	assert.Equal(t, "01", body)
+	resp, _ = serve(t, serveDigits, "GET", "/", "Range: bytes=0-1\r\n", "If-Range: W/"+etag+"\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+}
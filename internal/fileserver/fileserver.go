@@ -0,0 +1,247 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+const indexFile = "index.html"
+
+// FileServer serves the files under Root. Lookups go through os.Root, so
+// neither ".." nor a symlink can reach outside of it.
+type FileServer struct {
+	Root string
+	// Prefix is stripped from the request path before the lookup, for a
+	// server mounted on "/assets/" for instance.
+	Prefix string
+	// ListDirs lists the directories without an index.html instead of
+	// answering 404.
+	ListDirs bool
+}
+
+func New(root string) *FileServer {
+	return &FileServer{Root: root}
+}
+
+// Handle serves the file the request path points to. It has the signature
+// of server.Handler.
+func (fsrv *FileServer) Handle(w *response.Writer, req *request.Request) {
+	if !allowedMethod(w, req) {
+		return
+	}
+	urlPath := req.Path()
+	name, ok := cleanPath(strings.TrimPrefix(urlPath, fsrv.Prefix))
+	if !ok {
+		writeError(w, response.StatusNotFound)
+		return
+	}
+
+	root, err := os.OpenRoot(fsrv.Root)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		writeError(w, response.StatusInternalServerError)
+		return
+	}
+	defer root.Close()
+
+	f, err := root.Open(name)
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			redirect(w, req, path.Base(urlPath)+"/")
+			return
+		}
+		index, err := root.Open(path.Join(name, indexFile))
+		if err == nil {
+			defer index.Close()
+			indexInfo, err := index.Stat()
+			if err == nil && !indexInfo.IsDir() {
+				ServeContent(w, req, indexInfo.Name(), indexInfo.ModTime(), index)
+				return
+			}
+		}
+		if !fsrv.ListDirs {
+			writeError(w, response.StatusNotFound)
+			return
+		}
+		listDir(w, req, f)
+		return
+	}
+	ServeContent(w, req, info.Name(), info.ModTime(), f)
+}
+
+// ServeFile serves the file name, a path on disk that isn't checked: it
+// must not come from the request.
+func ServeFile(w *response.Writer, req *request.Request, name string) {
+	if !allowedMethod(w, req) {
+		return
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	if info.IsDir() {
+		writeError(w, response.StatusNotFound)
+		return
+	}
+	ServeContent(w, req, info.Name(), info.ModTime(), f)
+}
+
+func allowedMethod(w *response.Writer, req *request.Request) bool {
+	m := req.RequestLine.Method
+	if m == request.GET || m == request.HEAD {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	writeError(w, response.StatusMethodNotAllowed)
+	return false
+}
+
+// cleanPath decodes the request path and turns it into a name relative to
+// the root. Paths with a ".." segment or a NUL byte are refused.
+func cleanPath(p string) (string, bool) {
+	decoded, err := url.PathUnescape(p)
+	if err != nil || strings.ContainsAny(decoded, "\x00\\") {
+		return "", false
+	}
+	for seg := range strings.SplitSeq(decoded, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+	name := strings.TrimPrefix(path.Clean("/"+decoded), "/")
+	if name == "" {
+		return ".", true
+	}
+	return name, true
+}
+
+func listDir(w *response.Writer, req *request.Request, dir fs.ReadDirFile) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		writeError(w, response.StatusInternalServerError)
+		return
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	var b strings.Builder
+	title := html.EscapeString(req.Path())
+	fmt.Fprintf(&b, "<html>\n  <head>\n    <title>Index of %s</title>\n  </head>\n", title)
+	fmt.Fprintf(&b, "  <body>\n    <h1>Index of %s</h1>\n    <ul>\n", title)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(
+			&b, "      <li><a href=\"%s\">%s</a></li>\n",
+			(&url.URL{Path: "./" + name}).EscapedPath(), html.EscapeString(name),
+		)
+	}
+	b.WriteString("    </ul>\n  </body>\n</html>\n")
+	body := b.String()
+
+	err = w.WriteStatusLine(response.StatusOK)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		return
+	}
+	h := response.GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", "text/html; charset=utf-8")
+	err = w.WriteHeaders(h)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		return
+	}
+	if req.RequestLine.Method == request.HEAD {
+		return
+	}
+	_, err = w.WriteBody([]byte(body))
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+	}
+}
+
+// redirect sends the client to target, relative to the request path, with
+// the query kept.
+func redirect(w *response.Writer, req *request.Request, target string) {
+	if _, query, ok := strings.Cut(req.RequestLine.RequestTarget, "?"); ok {
+		target += "?" + query
+	}
+	err := w.WriteStatusLine(response.StatusMovedPermanently)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		return
+	}
+	h := response.GetDefaultHeaders(0)
+	h.Set("Location", target)
+	err = w.WriteHeaders(h)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+	}
+}
+
+func writeOpenError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, response.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, response.StatusForbidden)
+	default:
+		// os.Root refuse aussi les chemins qui sortent de la racine
+		w.Logger().Error("serving file failed", "err", err)
+		writeError(w, response.StatusNotFound)
+	}
+}
+
+func writeError(w *response.Writer, statusCode tools.StatusCode) {
+	body := strconv.Itoa(int(statusCode)) + " " + response.StatusText(statusCode) + "\n"
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		return
+	}
+	h := response.GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", "text/plain; charset=utf-8")
+	err = w.WriteHeaders(h)
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+		return
+	}
+	_, err = w.WriteBody([]byte(body))
+	if err != nil {
+		w.Logger().Error("serving file failed", "err", err)
+	}
+}
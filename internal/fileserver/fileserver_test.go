@@ -0,0 +1,119 @@
+package fileserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+func serve(t *testing.T, handle func(*response.Writer, *request.Request), method, target string, fields ...string) (*http.Response, string) {
+	req, err := request.RequestFromReader(strings.NewReader(
+		method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n" +
+			strings.Join(fields, "") + "\r\n",
+	))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	handle(&response.Writer{Connection: buf}, req)
+
+	httpReq, _ := http.NewRequest(method, target, nil)
+	resp, err := http.ReadResponse(bufio.NewReader(buf), httpReq)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func testRoot(t *testing.T) string {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "public")
+	files := map[string]string{
+		"public/hello.txt":       "hello world\n",
+		"public/site/index.html": "<h1>home</h1>",
+		"public/docs/a b.md":     "# a",
+		"public/docs/noext":      "<!DOCTYPE html><p>sniffed</p>",
+		"public/blob":            "\x00\x01\x02binary",
+		"secret.txt":             "do not serve",
+	}
+	for name, content := range files {
+		p := filepath.Join(parent, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	require.NoError(t, os.Symlink(
+		filepath.Join(parent, "secret.txt"), filepath.Join(root, "link.txt"),
+	))
+	return root
+}
+
+func TestFileServer(t *testing.T) {
+	fsrv := &FileServer{Root: testRoot(t), Prefix: "/static", ListDirs: true}
+
+	// Test: Plain file, type from extension
+	resp, body := serve(t, fsrv.Handle, "GET", "/static/hello.txt")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, int64(12), resp.ContentLength)
+	assert.Equal(t, "hello world\n", body)
+
+	// Test: HEAD has the headers without the body
+	resp, body = serve(t, fsrv.Handle, "HEAD", "/static/hello.txt")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "12", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "", body)
+
+	// Test: Sniffed types
+	resp, _ = serve(t, fsrv.Handle, "GET", "/static/docs/noext")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	resp, _ = serve(t, fsrv.Handle, "GET", "/static/blob")
+	assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+
+	// Test: Escaped path
+	resp, body = serve(t, fsrv.Handle, "GET", "/static/docs/a%20b.md")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "# a", body)
+
+	// Test: Traversal attempts
+	for _, target := range []string{
+		"/static/../secret.txt",
+		"/static/%2e%2e/secret.txt",
+		"/static/docs/..%2f..%2fsecret.txt",
+		"/static/link.txt",
+	} {
+		resp, body = serve(t, fsrv.Handle, "GET", target)
+		assert.Equal(t, 404, resp.StatusCode, target)
+		assert.NotContains(t, body, "do not serve", target)
+	}
+
+	// Test: Directory redirect, index and listing
+	resp, _ = serve(t, fsrv.Handle, "GET", "/static/site?x=1")
+	assert.Equal(t, 301, resp.StatusCode)
+	assert.Equal(t, "site/?x=1", resp.Header.Get("Location"))
+	_, body = serve(t, fsrv.Handle, "GET", "/static/site/")
+	assert.Equal(t, "<h1>home</h1>", body)
+	resp, body = serve(t, fsrv.Handle, "GET", "/static/docs/")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, body, `<a href="./a%20b.md">a b.md</a>`)
+	assert.Contains(t, body, `<a href="./noext">noext</a>`)
+
+	fsrv.ListDirs = false
+	resp, _ = serve(t, fsrv.Handle, "GET", "/static/docs/")
+	assert.Equal(t, 404, resp.StatusCode)
+
+	// Test: Missing file and bad method
+	resp, _ = serve(t, fsrv.Handle, "GET", "/static/nope")
+	assert.Equal(t, 404, resp.StatusCode)
+	resp, _ = serve(t, fsrv.Handle, "DELETE", "/static/hello.txt")
+	assert.Equal(t, 405, resp.StatusCode)
+	assert.Equal(t, "GET, HEAD", resp.Header.Get("Allow"))
+}
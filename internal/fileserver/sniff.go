@@ -0,0 +1,97 @@
+package fileserver
+
+import (
+	"bytes"
+	"mime"
+	"path/filepath"
+)
+
+// sniffLen is how much of a file is looked at to guess its type.
+const sniffLen = 512
+
+type signature struct {
+	offset      int
+	magic       []byte
+	contentType string
+}
+
+var signatures = []signature{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{0, []byte("RIFF"), "application/octet-stream"}, // affiné plus bas
+	{4, []byte("ftyp"), "video/mp4"},
+	{0, []byte("\x1a\x45\xdf\xa3"), "video/webm"},
+	{0, []byte("OggS"), "application/ogg"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("\x1f\x8b\x08"), "application/x-gzip"},
+	{0, []byte("\x00asm"), "application/wasm"},
+}
+
+// htmlPrefixes start an HTML document when a space or a '>' follows them.
+var htmlPrefixes = [][]byte{
+	[]byte("<!doctype html"),
+	[]byte("<html"),
+	[]byte("<head"),
+	[]byte("<body"),
+	[]byte("<script"),
+	[]byte("<p"),
+	[]byte("<div"),
+	[]byte("<h1"),
+	[]byte("<table"),
+}
+
+// contentType guesses the media type of a file from its extension, or from
+// its first bytes when the extension isn't known.
+func contentType(name string, head []byte) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	return sniff(head)
+}
+
+func sniff(head []byte) string {
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	for _, s := range signatures {
+		if len(head) < s.offset+len(s.magic) ||
+			!bytes.Equal(head[s.offset:s.offset+len(s.magic)], s.magic) {
+			continue
+		}
+		if string(s.magic) == "RIFF" && len(head) >= 12 {
+			switch string(head[8:12]) {
+			case "WEBP":
+				return "image/webp"
+			case "WAVE":
+				return "audio/wave"
+			case "AVI ":
+				return "video/avi"
+			}
+		}
+		return s.contentType
+	}
+
+	text := bytes.TrimLeft(head, "\t\n\x0c\r ")
+	lower := bytes.ToLower(text)
+	for _, prefix := range htmlPrefixes {
+		// la balise doit se terminer là : "<p" n'est pas "<path" ou "<plist"
+		if bytes.HasPrefix(lower, prefix) && len(lower) > len(prefix) &&
+			(lower[len(prefix)] == ' ' || lower[len(prefix)] == '>') {
+			return "text/html; charset=utf-8"
+		}
+	}
+	if bytes.HasPrefix(lower, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+	for _, b := range head {
+		// octets de contrôle qu'on ne trouve pas dans du texte
+		if b < 0x08 || b == 0x0b || (b > 0x0d && b < 0x1b) || (b > 0x1b && b < 0x20) {
+			return "application/octet-stream"
+		}
+	}
+	return "text/plain; charset=utf-8"
+}
@@ -0,0 +1,19 @@
+package fileserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniff(t *testing.T) {
+	// Test: HTML tags followed by a space or '>'
+	assert.Equal(t, "text/html; charset=utf-8", sniff([]byte("  <P>hello</p>")))
+	assert.Equal(t, "text/html; charset=utf-8", sniff([]byte("<p class=\"x\">hello</p>")))
+	assert.Equal(t, "text/html; charset=utf-8", sniff([]byte("<!DOCTYPE html>\n<html>")))
+
+	// Test: Longer tags sharing the prefix aren't HTML
+	assert.Equal(t, "text/plain; charset=utf-8", sniff([]byte("<plist version=\"1.0\">")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniff([]byte("<path d=\"M0 0\"/>")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniff([]byte("<p")))
+}
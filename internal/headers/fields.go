@@ -0,0 +1,429 @@
+package headers
+
+import (
+	"encoding/base64"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// Typed accessors over the common request fields. They are tolerant: a
+// malformed element is skipped rather than failing the whole field, and an
+// absent or unusable field is reported with ok = false or an empty slice.
+
+// QualityValue is an element of a list weighted with ";q=", as in
+// Accept-Encoding or Accept-Language.
+type QualityValue struct {
+	Value string
+	Q     float64
+}
+
+// MediaRange is an element of Accept.
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Q       float64
+}
+
+// ByteRange is a range of a Range header, bounds included. Start is -1 for
+// a suffix range ("-500": the last End bytes), End is -1 for an open range
+// ("500-").
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// ETag is an entity tag, Value is unquoted. The wildcard of If-Match and
+// If-None-Match is {Value: "*"}.
+type ETag struct {
+	Value string
+	Weak  bool
+}
+
+// ForwardedElement is one hop of a Forwarded header.
+type ForwardedElement struct {
+	For   string
+	By    string
+	Host  string
+	Proto string
+}
+
+// Accept returns the media ranges of Accept sorted by decreasing q, ties
+// keep the order of the header.
+func (h Headers) Accept() []MediaRange {
+	v, err := h.Get("accept")
+	if err != nil {
+		return []MediaRange{}
+	}
+	ranges := []MediaRange{}
+	for _, elem := range SplitList(v) {
+		mediaType, params, err := ParseMediaType(elem)
+		if err != nil {
+			continue
+		}
+		typ, sub, ok := strings.Cut(mediaType, "/")
+		if !ok || typ == "" || sub == "" || (typ == "*" && sub != "*") {
+			continue
+		}
+		q, ok := parseQ(params)
+		if !ok {
+			continue
+		}
+		delete(params, "q")
+		ranges = append(ranges, MediaRange{
+			Type: typ, Subtype: sub, Params: params, Q: q,
+		})
+	}
+	slices.SortStableFunc(ranges, func(a, b MediaRange) int {
+		return compareQ(a.Q, b.Q)
+	})
+	return ranges
+}
+
+// AcceptEncoding returns the codings of Accept-Encoding, lowercased and
+// sorted by decreasing q.
+func (h Headers) AcceptEncoding() []QualityValue {
+	return h.qualityList("accept-encoding", true)
+}
+
+// AcceptLanguage returns the language tags of Accept-Language sorted by
+// decreasing q.
+func (h Headers) AcceptLanguage() []QualityValue {
+	return h.qualityList("accept-language", false)
+}
+
+func (h Headers) qualityList(key string, lower bool) []QualityValue {
+	v, err := h.Get(key)
+	if err != nil {
+		return []QualityValue{}
+	}
+	values := []QualityValue{}
+	for _, elem := range SplitList(v) {
+		value, params, err := ParseMediaType(elem)
+		if err != nil {
+			continue
+		}
+		q, ok := parseQ(params)
+		if !ok {
+			continue
+		}
+		if !lower {
+			// ParseMediaType met tout en minuscules
+			value, _, _ = strings.Cut(elem, ";")
+			value = strings.TrimSpace(value)
+		}
+		values = append(values, QualityValue{Value: value, Q: q})
+	}
+	slices.SortStableFunc(values, func(a, b QualityValue) int {
+		return compareQ(a.Q, b.Q)
+	})
+	return values
+}
+
+// Authorization splits Authorization into its scheme and credentials.
+// Schemes are case-insensitive, compare them with strings.EqualFold.
+func (h Headers) Authorization() (scheme, credentials string, ok bool) {
+	v, err := h.Get("authorization")
+	if err != nil {
+		return "", "", false
+	}
+	scheme, credentials, _ = strings.Cut(strings.TrimSpace(v), " ")
+	if scheme == "" {
+		return "", "", false
+	}
+	return scheme, strings.TrimSpace(credentials), true
+}
+
+// BasicAuth decodes the credentials of the Basic scheme.
+func (h Headers) BasicAuth() (user, password string, ok bool) {
+	scheme, credentials, ok := h.Authorization()
+	if !ok || !strings.EqualFold(scheme, "basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// Range returns the byte ranges of Range. It is not ok when the field is
+// absent, uses another unit or is malformed: the field must then be ignored.
+func (h Headers) Range() ([]ByteRange, bool) {
+	v, err := h.Get("range")
+	if err != nil {
+		return nil, false
+	}
+	return ParseRange(v)
+}
+
+// ParseRange parses a "bytes=..." range specifier.
+func ParseRange(v string) ([]ByteRange, bool) {
+	unit, set, ok := strings.Cut(strings.TrimSpace(v), "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, false
+	}
+	ranges := []ByteRange{}
+	for _, spec := range SplitList(set) {
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, false
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		r := ByteRange{Start: -1, End: -1}
+		var err error
+		if first != "" {
+			r.Start, err = strconv.ParseInt(first, 10, 64)
+			if err != nil || r.Start < 0 {
+				return nil, false
+			}
+		}
+		if last != "" {
+			r.End, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || r.End < 0 {
+				return nil, false
+			}
+		}
+		if r.Start == -1 && r.End == -1 {
+			return nil, false
+		}
+		if r.Start != -1 && r.End != -1 && r.End < r.Start {
+			return nil, false
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, false
+	}
+	return ranges, true
+}
+
+// IfNoneMatch returns the entity tags of If-None-Match.
+func (h Headers) IfNoneMatch() []ETag {
+	v, err := h.Get("if-none-match")
+	if err != nil {
+		return []ETag{}
+	}
+	return ParseETags(v)
+}
+
+// IfMatch returns the entity tags of If-Match.
+func (h Headers) IfMatch() []ETag {
+	v, err := h.Get("if-match")
+	if err != nil {
+		return []ETag{}
+	}
+	return ParseETags(v)
+}
+
+// ParseETags parses a comma separated list of entity tags, or "*".
+func ParseETags(v string) []ETag {
+	tags := []ETag{}
+	for _, elem := range SplitList(v) {
+		if elem == "*" {
+			tags = append(tags, ETag{Value: "*"})
+			continue
+		}
+		tag, ok := ParseETag(elem)
+		if ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ParseETag parses `"value"` or `W/"value"`.
+func ParseETag(v string) (ETag, bool) {
+	v = strings.TrimSpace(v)
+	weak := false
+	if rest, ok := strings.CutPrefix(v, "W/"); ok {
+		weak = true
+		v = rest
+	}
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return ETag{}, false
+	}
+	v = v[1 : len(v)-1]
+	if strings.Contains(v, `"`) {
+		return ETag{}, false
+	}
+	return ETag{Value: v, Weak: weak}, true
+}
+
+// String formats the tag for an ETag header.
+func (t ETag) String() string {
+	if t.Value == "*" {
+		return "*"
+	}
+	if t.Weak {
+		return `W/"` + t.Value + `"`
+	}
+	return `"` + t.Value + `"`
+}
+
+// IfModifiedSince returns the date of If-Modified-Since.
+func (h Headers) IfModifiedSince() (time.Time, bool) {
+	return h.Time("if-modified-since")
+}
+
+// IfUnmodifiedSince returns the date of If-Unmodified-Since.
+func (h Headers) IfUnmodifiedSince() (time.Time, bool) {
+	return h.Time("if-unmodified-since")
+}
+
+// Time parses an HTTP date field, in IMF-fixdate or in one of the obsolete
+// RFC 850 and asctime formats.
+func (h Headers) Time(key string) (time.Time, bool) {
+	v, err := h.Get(key)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ParseTime(v)
+}
+
+var timeFormats = []string{
+	tools.TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+func ParseTime(v string) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	for _, layout := range timeFormats {
+		t, err := time.Parse(layout, v)
+		if err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ContentType returns the media type of Content-Type and its parameters.
+func (h Headers) ContentType() (string, map[string]string, bool) {
+	v, err := h.Get("content-type")
+	if err != nil {
+		return "", nil, false
+	}
+	mediaType, params, err := ParseMediaType(v)
+	if err != nil {
+		return "", nil, false
+	}
+	return mediaType, params, true
+}
+
+// Forwarded returns the hops of Forwarded, closest to the client first.
+// Quoted values such as IPv6 addresses are unquoted.
+func (h Headers) Forwarded() []ForwardedElement {
+	v, err := h.Get("forwarded")
+	if err != nil {
+		return []ForwardedElement{}
+	}
+	elems := []ForwardedElement{}
+	for _, elem := range SplitList(v) {
+		// un élément n'a pas de type, on réutilise le parseur de paramètres
+		_, params, _ := ParseMediaType("x;" + elem)
+		e := ForwardedElement{
+			For:   params["for"],
+			By:    params["by"],
+			Host:  params["host"],
+			Proto: strings.ToLower(params["proto"]),
+		}
+		if e != (ForwardedElement{}) {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// XForwardedFor returns the addresses of X-Forwarded-For, client first.
+func (h Headers) XForwardedFor() []string {
+	v, err := h.Get("x-forwarded-for")
+	if err != nil {
+		return []string{}
+	}
+	return SplitList(v)
+}
+
+// ForwardedFor returns the client addresses of Forwarded, or of
+// X-Forwarded-For when there is no Forwarded field, without ports nor
+// brackets. Obfuscated identifiers like "_hidden" or "unknown" are kept.
+func (h Headers) ForwardedFor() []string {
+	addrs := []string{}
+	for _, e := range h.Forwarded() {
+		if e.For != "" {
+			addrs = append(addrs, stripPort(e.For))
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+	for _, a := range h.XForwardedFor() {
+		addrs = append(addrs, stripPort(a))
+	}
+	return addrs
+}
+
+func stripPort(addr string) string {
+	if ap, err := netip.ParseAddrPort(addr); err == nil {
+		return ap.Addr().String()
+	}
+	return strings.Trim(addr, "[]")
+}
+
+// SplitList splits a comma separated field, ignoring the commas of quoted
+// strings, and drops the empty elements.
+func SplitList(v string) []string {
+	elems := []string{}
+	start := 0
+	quoted := false
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				if e := strings.TrimSpace(v[start:i]); e != "" {
+					elems = append(elems, e)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if e := strings.TrimSpace(v[start:]); e != "" {
+		elems = append(elems, e)
+	}
+	return elems
+}
+
+// parseQ reads the weight of an element, 1 by default. Weights outside of
+// [0, 1] or not a number are not ok.
+func parseQ(params map[string]string) (float64, bool) {
+	v, ok := params["q"]
+	if !ok {
+		return 1, true
+	}
+	q, err := strconv.ParseFloat(v, 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0, false
+	}
+	return q, true
+}
+
+func compareQ(a, b float64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
@@ -25,7 +25,7 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	strData := string(data)[:crlfIdx]
 	keyIdx := strings.Index(strData, ":")
-	if keyIdx == -1 {
+	if keyIdx <= 0 {
 		return 0, false, fmt.Errorf("headers key not found: %s", strData)
 	} else if strData[keyIdx-1] == ' ' {
 		return 0, false, fmt.Errorf("malformed headers, no OWS next to ':' permitted: %s", strData[:keyIdx])
@@ -45,23 +45,11 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	return crlfIdx + 2, false, nil
 }
 
+// Set adds value to key, after the previous values when key is already
+// there. The field is split on its first ':' by Parse, value is kept as is
+// but for the surrounding whitespace, "script-src https: 'self'" included.
 func (h Headers) Set(key, value string) error {
-	valIdx := strings.LastIndex(value, ":")
-	if valIdx != -1 {
-		if value[valIdx-1] == ' ' || value[valIdx+1] == ' ' {
-			return fmt.Errorf(
-				"malformed headers, no OWS next to ':' permitted: %s",
-				value,
-			)
-		}
-		value = fmt.Sprintf(
-			"%s%s",
-			strings.TrimSpace(value[:valIdx]),
-			strings.TrimSpace(value[valIdx:]),
-		)
-	} else {
-		value = strings.TrimSpace(value)
-	}
+	value = strings.TrimSpace(value)
 	_, exist := h[key]
 	if !exist {
 		h[key] = value
@@ -73,8 +61,30 @@ func (h Headers) Set(key, value string) error {
 
 func (h Headers) Get(key string) (string, error) {
 	v, ok := h[strings.ToLower(key)]
-	if !ok {
-		return "", fmt.Errorf("key %s not found in headers", key)
+	if ok {
+		return v, nil
+	}
+	// les headers de réponse gardent la casse donnée à Set
+	for k, v := range h {
+		if strings.EqualFold(k, key) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("key %s not found in headers", key)
+}
+
+// Replace sets key to value, dropping the previous values instead of
+// appending to them like Set does.
+func (h Headers) Replace(key, value string) error {
+	h.Del(key)
+	return h.Set(key, value)
+}
+
+// Del removes key, whatever its case.
+func (h Headers) Del(key string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
 	}
-	return v, nil
 }
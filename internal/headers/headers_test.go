@@ -119,13 +119,14 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
-	// Test: Invalid single header with space
-	example = "Host: localhost :42069\r\n"
+	// Test: Only the first ':' splits, the value keeps the others
+	example = "Content-Security-Policy: script-src 'self' https: 'unsafe-inline'\r\n"
 	headers = NewHeaders()
 	data = []byte(example + "\r\n")
 	n, done, err = headers.Parse(data)
-	require.Error(t, err)
-	assert.Equal(t, 0, n)
+	require.NoError(t, err)
+	assert.Equal(t, "script-src 'self' https: 'unsafe-inline'", headers["content-security-policy"])
+	assert.Equal(t, len(example), n)
 	assert.False(t, done)
 
 	// Test: Invalid field-name header
@@ -136,3 +137,27 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 }
+
+func TestHeadersGetReplaceDel(t *testing.T) {
+	// Test: Get ignores the case of keys given to Set
+	headers := NewHeaders()
+	require.NoError(t, headers.Set("Content-Type", "text/html"))
+	v, err := headers.Get("content-type")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", v)
+
+	// Test: Replace drops the previous values
+	require.NoError(t, headers.Set("Vary", "Accept"))
+	require.NoError(t, headers.Set("Vary", "Accept-Encoding"))
+	assert.Equal(t, "Accept, Accept-Encoding", headers["Vary"])
+	require.NoError(t, headers.Replace("vary", "Cookie"))
+	v, err = headers.Get("Vary")
+	require.NoError(t, err)
+	assert.Equal(t, "Cookie", v)
+	assert.Equal(t, 2, len(headers))
+
+	// Test: Del
+	headers.Del("CONTENT-TYPE")
+	_, err = headers.Get("Content-Type")
+	require.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package headers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ParseMediaType splits a Content-Type or Content-Disposition value into its
+// lowercased type and its parameters. Parameter names are lowercased, quoted
+// values are unescaped and RFC 8187 extended values (name*=...) take
+// precedence over the plain ones. Malformed parameters are skipped.
+func ParseMediaType(v string) (string, map[string]string, error) {
+	mediaType, rest, _ := strings.Cut(v, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return "", nil, errors.New("empty media type")
+	}
+
+	params := map[string]string{}
+	extended := map[string]string{}
+	for rest != "" {
+		var name, value string
+		name, value, rest = nextParam(rest)
+		if name == "" {
+			continue
+		}
+		if base, ok := strings.CutSuffix(name, "*"); ok {
+			if decoded, ok := decodeExtValue(value); ok {
+				extended[base] = decoded
+			}
+			continue
+		}
+		params[name] = value
+	}
+	for k, v := range extended {
+		params[k] = v
+	}
+	return mediaType, params, nil
+}
+
+// nextParam reads one "name=value" off s, up to the next ';' outside of a
+// quoted string, and returns what follows.
+func nextParam(s string) (name, value, rest string) {
+	s = strings.TrimLeft(s, " \t;")
+	eq := strings.IndexAny(s, "=;")
+	if eq == -1 || s[eq] == ';' {
+		// pas de valeur, on ignore le paramètre
+		if eq == -1 {
+			return "", "", ""
+		}
+		return "", "", s[eq:]
+	}
+	name = strings.ToLower(strings.TrimSpace(s[:eq]))
+	s = strings.TrimLeft(s[eq+1:], " \t")
+
+	if !strings.HasPrefix(s, `"`) {
+		value, rest, _ = strings.Cut(s, ";")
+		return name, strings.TrimSpace(value), rest
+	}
+
+	var b strings.Builder
+	i := 1
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			b.WriteByte(s[i])
+			continue
+		}
+		if c == '"' {
+			break
+		}
+		b.WriteByte(c)
+	}
+	rest = ""
+	if i < len(s) {
+		_, rest, _ = strings.Cut(s[i+1:], ";")
+	}
+	return name, b.String(), rest
+}
+
+// decodeExtValue decodes charset'language'percent-encoded values. Only
+// UTF-8 and US-ASCII are supported.
+func decodeExtValue(v string) (string, bool) {
+	parts := strings.SplitN(v, "'", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8", "us-ascii":
+	default:
+		return "", false
+	}
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+	return decoded, true
+}
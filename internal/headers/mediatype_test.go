@@ -0,0 +1,44 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaType(t *testing.T) {
+	// Test: Type and parameters
+	mediaType, params, err := ParseMediaType(
+		"Multipart/Form-Data; Boundary=----abc; charset=utf-8",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+	assert.Equal(t, "----abc", params["boundary"])
+	assert.Equal(t, "utf-8", params["charset"])
+
+	// Test: Quoted values with ';' and escapes
+	_, params, err = ParseMediaType(
+		`form-data; name="a;b"; filename="say \"hi\".txt"`,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "a;b", params["name"])
+	assert.Equal(t, `say "hi".txt`, params["filename"])
+
+	// Test: Extended value wins
+	_, params, err = ParseMediaType(
+		`attachment; filename="euro.txt"; filename*=UTF-8''%E2%82%AC.txt`,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "€.txt", params["filename"])
+
+	// Test: Malformed parameters are skipped
+	mediaType, params, err = ParseMediaType("text/html; ; novalue; a=1")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", mediaType)
+	assert.Equal(t, map[string]string{"a": "1"}, params)
+
+	// Test: Empty media type
+	_, _, err = ParseMediaType(" ; a=1")
+	require.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+)
+
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastConn
+	// ConsistentHash sends the same key to the same backend, and moves few
+	// keys when a backend comes or goes.
+	ConsistentHash
+)
+
+const (
+	DefaultMaxFails    = 3
+	DefaultFailTimeout = 10 * time.Second
+
+	// ringReplicas is the number of points of each backend on the hash ring,
+	// enough to spread the keys evenly.
+	ringReplicas = 100
+)
+
+// ParseStrategy reads "round-robin", "least-conn" or "hash".
+func ParseStrategy(s string) (Strategy, error) {
+	switch s {
+	case "round-robin", "":
+		return RoundRobin, nil
+	case "least-conn":
+		return LeastConn, nil
+	case "hash":
+		return ConsistentHash, nil
+	}
+	return 0, fmt.Errorf("unknown balancing strategy: %s", s)
+}
+
+// Backend is one upstream of a Pool.
+type Backend struct {
+	URL *url.URL
+
+	active atomic.Int64
+	// protégés par Pool.mu
+	fails        int
+	ejectedUntil time.Time
+	down         bool
+}
+
+// Active returns the number of requests in flight on the backend.
+func (b *Backend) Active() int64 {
+	return b.active.Load()
+}
+
+// Pool spreads the requests of a ReverseProxy over several upstreams. A
+// backend is left out while ejected after MaxFails failures in a row, and
+// while the active health checks find it down.
+type Pool struct {
+	Strategy Strategy
+	// HashHeader is the field hashed by ConsistentHash, the client IP is used
+	// when empty or missing from the request.
+	HashHeader string
+	// MaxFails failures in a row eject a backend for FailTimeout.
+	MaxFails    int
+	FailTimeout time.Duration
+	// Log receives the failed health checks, nil logs to slog.Default.
+	Log *slog.Logger
+
+	backends []*Backend
+	ring     []ringPoint
+	next     atomic.Uint64
+	mu       sync.Mutex
+}
+
+type ringPoint struct {
+	hash    uint32
+	backend *Backend
+}
+
+func NewPool(strategy Strategy, upstreams ...string) (*Pool, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("empty pool")
+	}
+	p := &Pool{
+		Strategy:    strategy,
+		MaxFails:    DefaultMaxFails,
+		FailTimeout: DefaultFailTimeout,
+	}
+	for _, upstream := range upstreams {
+		rp, err := New(upstream)
+		if err != nil {
+			return nil, err
+		}
+		b := &Backend{URL: rp.Upstream}
+		p.backends = append(p.backends, b)
+		for i := range ringReplicas {
+			p.ring = append(p.ring, ringPoint{
+				hash:    crc32.ChecksumIEEE([]byte(upstream + "#" + strconv.Itoa(i))),
+				backend: b,
+			})
+		}
+	}
+	slices.SortFunc(p.ring, func(a, b ringPoint) int {
+		return int(int64(a.hash) - int64(b.hash))
+	})
+	return p, nil
+}
+
+// Backends returns the upstreams of the pool, in the order given to NewPool.
+func (p *Pool) Backends() []*Backend {
+	return p.backends
+}
+
+// Available reports whether b can take requests: not ejected nor down.
+func (p *Pool) Available(b *Backend) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.available(b, time.Now())
+}
+
+func (p *Pool) available(b *Backend, now time.Time) bool {
+	return !b.down && !now.Before(b.ejectedUntil)
+}
+
+// Pick chooses the backend for req, nil when none is available. The request
+// counts in the Active of the backend until Release: LeastConn sees it as
+// soon as it is picked.
+func (p *Pool) Pick(req *request.Request) *Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.pick(req, time.Now())
+	if b != nil {
+		b.active.Add(1)
+	}
+	return b
+}
+
+// Release ends a request to b chosen by Pick.
+func (p *Pool) Release(b *Backend) {
+	b.active.Add(-1)
+}
+
+func (p *Pool) logger() *slog.Logger {
+	if p.Log == nil {
+		return slog.Default()
+	}
+	return p.Log
+}
+
+func (p *Pool) pick(req *request.Request, now time.Time) *Backend {
+	switch p.Strategy {
+	case ConsistentHash:
+		key := p.hashKey(req)
+		h := crc32.ChecksumIEEE([]byte(key))
+		start, _ := slices.BinarySearchFunc(p.ring, h, func(pt ringPoint, h uint32) int {
+			return int(int64(pt.hash) - int64(h))
+		})
+		// le premier point disponible après la clé, dans le sens du cercle
+		for i := range p.ring {
+			pt := p.ring[(start+i)%len(p.ring)]
+			if p.available(pt.backend, now) {
+				return pt.backend
+			}
+		}
+		return nil
+	case LeastConn:
+		// le départ tourne pour départager les égalités
+		offset := p.next.Add(1)
+		var best *Backend
+		for i := range p.backends {
+			b := p.backends[(offset+uint64(i))%uint64(len(p.backends))]
+			if p.available(b, now) && (best == nil || b.Active() < best.Active()) {
+				best = b
+			}
+		}
+		return best
+	default:
+		for range p.backends {
+			b := p.backends[(p.next.Add(1)-1)%uint64(len(p.backends))]
+			if p.available(b, now) {
+				return b
+			}
+		}
+		return nil
+	}
+}
+
+func (p *Pool) hashKey(req *request.Request) string {
+	if p.HashHeader != "" {
+		if v, err := req.Headers.Get(p.HashHeader); err == nil {
+			return v
+		}
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// report records the outcome of a request to b, for the passive health
+// tracking.
+func (p *Pool) report(b *Backend, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !failed {
+		b.fails = 0
+		return
+	}
+	b.fails++
+	if p.MaxFails > 0 && b.fails >= p.MaxFails {
+		b.fails = 0
+		b.ejectedUntil = time.Now().Add(p.FailTimeout)
+	}
+}
+
+// setDown records the result of an active health check.
+func (p *Pool) setDown(b *Backend, down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.down = down
+}
+
+// String lists the backends and their state, for the logs.
+func (p *Pool) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	parts := []string{}
+	for _, b := range p.backends {
+		state := "up"
+		if !p.available(b, now) {
+			state = "down"
+		}
+		parts = append(parts, fmt.Sprintf("%s(%s, %d active)", b.URL, state, b.Active()))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+)
+
+// namedUpstreams starts n upstreams answering their index.
+func namedUpstreams(t *testing.T, n int) []string {
+	urls := []string{}
+	for i := range n {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, i)
+		}))
+		t.Cleanup(upstream.Close)
+		urls = append(urls, upstream.URL)
+	}
+	return urls
+}
+
+func pick(t *testing.T, pool *Pool, remoteAddr, fields string) int {
+	req, err := request.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET / HTTP/1.1\r\nHost: localhost\r\n" + fields + "\r\n",
+	)))
+	require.NoError(t, err)
+	req.RemoteAddr = remoteAddr
+	b := pool.Pick(req)
+	require.NotNil(t, b)
+	for i, other := range pool.Backends() {
+		if other == b {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestPoolStrategies(t *testing.T) {
+	urls := namedUpstreams(t, 3)
+
+	// Test: Round-robin through the proxy
+	pool, err := NewPool(RoundRobin, urls...)
+	require.NoError(t, err)
+	p := NewBalanced(pool)
+	got := []string{}
+	for range 6 {
+		_, body := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		got = append(got, body)
+	}
+	assert.Equal(t, []string{"0", "1", "2", "0", "1", "2"}, got)
+
+	// Test: Least connections, a picked backend counts right away
+	pool, err = NewPool(LeastConn, urls...)
+	require.NoError(t, err)
+	backends := pool.Backends()
+	backends[0].active.Store(4)
+	backends[1].active.Store(1)
+	backends[2].active.Store(3)
+	for range 2 {
+		assert.Equal(t, 1, pick(t, pool, "10.0.0.1:1000", ""))
+	}
+	assert.EqualValues(t, 3, backends[1].Active())
+	pool.Release(backends[1])
+	pool.Release(backends[1])
+	assert.Equal(t, 1, pick(t, pool, "10.0.0.1:1000", ""))
+
+	// Test: Consistent hash by client IP and by header
+	pool, err = NewPool(ConsistentHash, urls...)
+	require.NoError(t, err)
+	first := pick(t, pool, "10.0.0.1:1000", "")
+	assert.Equal(t, first, pick(t, pool, "10.0.0.1:2000", ""))
+	pool.HashHeader = "X-User"
+	seen := map[int]bool{}
+	keys := map[string]int{}
+	for i := range 50 {
+		user := fmt.Sprintf("user-%d", i)
+		keys[user] = pick(t, pool, "10.0.0.1:1000", "X-User: "+user+"\r\n")
+		seen[keys[user]] = true
+		assert.Equal(t, keys[user], pick(t, pool, "10.0.0.2:1000", "X-User: "+user+"\r\n"))
+	}
+	assert.Len(t, seen, 3)
+
+	// Test: Only the keys of a backend that goes away move
+	pool.setDown(backends[0], true)
+	for user, before := range keys {
+		after := pick(t, pool, "10.0.0.1:1000", "X-User: "+user+"\r\n")
+		if before != 0 {
+			assert.Equal(t, before, after, user)
+		}
+	}
+}
+
+func TestPoolPassiveHealth(t *testing.T) {
+	urls := namedUpstreams(t, 1)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	pool, err := NewPool(RoundRobin, down.URL, urls[0])
+	require.NoError(t, err)
+	pool.MaxFails = 2
+	p := NewBalanced(pool)
+
+	// Test: The failing backend is ejected after MaxFails errors
+	codes := []int{}
+	for range 6 {
+		resp, _ := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		codes = append(codes, resp.StatusCode)
+	}
+	assert.Equal(t, []int{502, 200, 502, 200, 200, 200}, codes)
+	assert.False(t, pool.Available(pool.Backends()[0]))
+
+	// Test: It comes back after FailTimeout
+	pool.mu.Lock()
+	pool.Backends()[0].ejectedUntil = time.Now()
+	pool.mu.Unlock()
+	assert.True(t, pool.Available(pool.Backends()[0]))
+
+	// Test: No backend left
+	pool, err = NewPool(RoundRobin, down.URL)
+	require.NoError(t, err)
+	pool.MaxFails = 1
+	p = NewBalanced(pool)
+	resp, _ := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 502, resp.StatusCode)
+	resp, _ = proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 503, resp.StatusCode)
+}
+
+func TestPoolActiveHealth(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+	pool, err := NewPool(RoundRobin, upstream.URL)
+	require.NoError(t, err)
+	b := pool.Backends()[0]
+
+	// Test: The probe marks the backend down then up again
+	stop := pool.StartHealthChecks("/healthz", 10*time.Millisecond, time.Second)
+	defer stop()
+	assert.True(t, pool.Available(b))
+	healthy.Store(false)
+	assert.Eventually(t, func() bool { return !pool.Available(b) }, time.Second, 5*time.Millisecond)
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return pool.Available(b) }, time.Second, 5*time.Millisecond)
+}
+
+func TestParseStrategy(t *testing.T) {
+	for s, want := range map[string]Strategy{
+		"round-robin": RoundRobin,
+		"least-conn":  LeastConn,
+		"hash":        ConsistentHash,
+	} {
+		got, err := ParseStrategy(s)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseStrategy("random")
+	assert.Error(t, err)
+}
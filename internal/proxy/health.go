@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/client"
+)
+
+// StartHealthChecks sends a GET on path to every backend now and then each
+// interval, until stop is called. A backend is down while its probe fails or
+// answers with a status >= 400, whatever the passive tracking says.
+func (p *Pool) StartHealthChecks(path string, interval, timeout time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &client.Client{ConnectTimeout: timeout}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.probeAll(ctx, c, path, timeout)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		c.CloseIdleConnections()
+	}
+}
+
+func (p *Pool) probeAll(ctx context.Context, c *client.Client, path string, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target := b.URL.Scheme + "://" + b.URL.Host + joinPath(b.URL.EscapedPath(), path)
+			err := probe(ctx, c, target, timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				p.logger().Warn("health check failed", "backend", b.URL.String(), "err", err)
+			}
+			p.setDown(b, err != nil)
+		}()
+	}
+	wg.Wait()
+}
+
+func probe(ctx context.Context, c *client.Client, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := client.NewRequest("GET", target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/client"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// hopHeaders only concern one connection, they are never forwarded, nor the
+// ones listed in Connection.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReverseProxy forwards the requests to an upstream server and relays its
+// responses: status, headers, body and trailers.
+type ReverseProxy struct {
+	// Upstream is where the requests go. Its path is prepended to the path
+	// of the request.
+	Upstream *url.URL
+	// Pool, when set, replaces Upstream: each request goes to one of its
+	// backends.
+	Pool *Pool
+	// StripPrefix is removed from the request path first, for a proxy
+	// mounted on "/api/" for instance.
+	StripPrefix string
+	// PreserveHost forwards the Host of the client instead of the one of
+	// Upstream.
+	PreserveHost bool
+	// Client sends the requests upstream. When nil, a client with
+	// ConnectTimeout is used.
+	Client *client.Client
+
+	// ConnectTimeout bounds the dial to the upstream, ResponseHeaderTimeout
+	// the wait for its status line and headers once the request is sent, and
+	// Timeout the whole exchange, body included. Zero means no limit. The
+	// first two are those of the default client, a Client has its own.
+	ConnectTimeout        time.Duration
+	ResponseHeaderTimeout time.Duration
+	Timeout               time.Duration
+
+	clientOnce sync.Once
+	client     *client.Client
+}
+
+var (
+	errTimeout    = errors.New("upstream timeout")
+	errClientGone = errors.New("client gone")
+)
+
+func New(upstream string) (*ReverseProxy, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream: %s", upstream)
+	}
+	return &ReverseProxy{Upstream: u}, nil
+}
+
+// NewBalanced returns a proxy that spreads the requests over pool.
+func NewBalanced(pool *Pool) *ReverseProxy {
+	return &ReverseProxy{Pool: pool}
+}
+
+// Handle forwards req. It has the signature of server.Handler.
+func (p *ReverseProxy) Handle(w *response.Writer, req *request.Request) {
+	upstream := p.Upstream
+	var backend *Backend
+	if p.Pool != nil {
+		backend = p.Pool.Pick(req)
+		if backend == nil {
+			w.Logger().Warn("no upstream available", "pool", p.Pool.String())
+			writeError(w, response.StatusServiceUnavailable)
+			return
+		}
+		upstream = backend.URL
+		defer p.Pool.Release(backend)
+	}
+
+	// le contexte de la requête est annulé quand le client s'en va
+	ctx, cancel := context.WithCancelCause(req.Context())
+	defer cancel(nil)
+	if p.Timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeoutCause(ctx, p.Timeout, errTimeout)
+		defer stop()
+	}
+	outReq, err := p.outgoing(req, upstream)
+	if err != nil {
+		w.Logger().Warn("invalid request to proxy", "err", err)
+		writeError(w, response.StatusBadRequest)
+		return
+	}
+
+	resp, err := p.upstreamClient().Do(ctx, outReq)
+	if err != nil && errors.Is(req.Context().Err(), context.DeadlineExceeded) {
+		w.Logger().Warn("request timeout, upstream request cancelled", "upstream", upstream.String(), "err", err)
+		writeError(w, response.StatusGatewayTimeout)
+		return
+	}
+	if err != nil && req.Context().Err() != nil {
+		w.Logger().Info("client gone, upstream request cancelled", "upstream", upstream.String(), "err", err)
+		return
+	}
+	if backend != nil {
+		p.Pool.report(backend, err != nil || unhealthyStatus(resp.StatusCode))
+	}
+	if err != nil {
+		w.Logger().Error("upstream request failed", "upstream", upstream.String(), "err", err)
+		if timedOut(ctx, err) {
+			writeError(w, response.StatusGatewayTimeout)
+		} else {
+			writeError(w, response.StatusBadGateway)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	// passé les en-têtes, une erreur ne peut plus changer le statut : la
+	// réponse est coupée sans le dernier chunk et le client le voit. Un
+	// client parti fait échouer l'écriture, la requête amont est annulée.
+	err = relay(w, req, resp)
+	if err != nil {
+		w.Logger().Error("relaying upstream response failed", "upstream", upstream.String(), "err", err)
+		cancel(errClientGone)
+	}
+}
+
+func (p *ReverseProxy) upstreamClient() *client.Client {
+	p.clientOnce.Do(func() {
+		p.client = p.Client
+		if p.client == nil {
+			p.client = &client.Client{
+				ConnectTimeout:        p.ConnectTimeout,
+				ResponseHeaderTimeout: p.ResponseHeaderTimeout,
+			}
+		}
+	})
+	return p.client
+}
+
+// timedOut tells a timeout, answered with a 504, from the other upstream
+// failures answered with a 502.
+func timedOut(ctx context.Context, err error) bool {
+	if errors.Is(context.Cause(ctx), errTimeout) ||
+		errors.Is(err, client.ErrResponseHeaderTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// outgoing builds the upstream request: same method, headers and body,
+// without the hop-by-hop headers and with the forwarding ones.
+func (p *ReverseProxy) outgoing(req *request.Request, upstream *url.URL) (*client.Request, error) {
+	rawPath, query, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	if !strings.HasPrefix(rawPath, "/") {
+		return nil, fmt.Errorf("unsupported request target: %s", rawPath)
+	}
+	rawPath = strings.TrimPrefix(rawPath, p.StripPrefix)
+	target := upstream.Scheme + "://" + upstream.Host +
+		joinPath(upstream.EscapedPath(), rawPath)
+	switch {
+	case upstream.RawQuery == "" && query != "":
+		target += "?" + query
+	case upstream.RawQuery != "" && query == "":
+		target += "?" + upstream.RawQuery
+	case upstream.RawQuery != "":
+		target += "?" + upstream.RawQuery + "&" + query
+	}
+
+	outReq, err := client.NewRequest(req.RequestLine.Method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cl, err := req.Headers.Get("content-length"); err == nil {
+		outReq.ContentLength, err = strconv.ParseInt(cl, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if outReq.ContentLength > 0 {
+			outReq.Body = req.BodyReader()
+		}
+	} else if req.RequestLine.Method != request.GET && req.RequestLine.Method != request.HEAD {
+		// corps décodé par le serveur : longueur inconnue, envoyé en chunked
+		outReq.Body = req.BodyReader()
+		outReq.ContentLength = -1
+	}
+
+	connection, _ := req.Headers.Get("connection")
+	dropped := droppedHeaders(connection)
+	for k, v := range req.Headers {
+		if dropped[strings.ToLower(k)] {
+			continue
+		}
+		outReq.Headers[k] = v
+	}
+
+	host, _ := req.Headers.Get("host")
+	if p.PreserveHost && host != "" {
+		outReq.Host = host
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	addForwarded(outReq.Headers, req.RemoteAddr, host, proto)
+	return outReq, nil
+}
+
+// unhealthyStatus are the answers of a backend that counts as failures for
+// the passive health tracking: it is there but can't serve.
+func unhealthyStatus(statusCode int) bool {
+	return statusCode == 502 || statusCode == 503 || statusCode == 504
+}
+
+// droppedHeaders lists the lowercase names of the fields that mustn't be
+// forwarded: hopHeaders, the options of the Connection value, and the ones
+// the client sets itself.
+func droppedHeaders(connection string) map[string]bool {
+	dropped := map[string]bool{"host": true, "content-length": true}
+	for _, k := range hopHeaders {
+		dropped[strings.ToLower(k)] = true
+	}
+	for _, opt := range headers.SplitList(connection) {
+		dropped[strings.ToLower(opt)] = true
+	}
+	return dropped
+}
+
+// addForwarded appends the client to Forwarded and X-Forwarded-For, and
+// sets X-Forwarded-Host and X-Forwarded-Proto.
+func addForwarded(h headers.Headers, remoteAddr, host, proto string) {
+	clientIP := remoteAddr
+	if ip, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		clientIP = ip
+	}
+
+	elem := []string{}
+	if clientIP != "" {
+		node := clientIP
+		if strings.Contains(clientIP, ":") {
+			node = "[" + clientIP + "]"
+		}
+		elem = append(elem, "for="+forwardedValue(node))
+	}
+	if host != "" {
+		elem = append(elem, "host="+forwardedValue(host))
+	}
+	elem = append(elem, "proto="+proto)
+	appendList(h, "Forwarded", strings.Join(elem, ";"))
+
+	if clientIP != "" {
+		appendList(h, "X-Forwarded-For", clientIP)
+	}
+	if host != "" {
+		h.Del("X-Forwarded-Host")
+		h["X-Forwarded-Host"] = host
+	}
+	h.Del("X-Forwarded-Proto")
+	h["X-Forwarded-Proto"] = proto
+}
+
+// forwardedValue quotes v when it isn't a token, an IPv6 or a port always
+// needs it.
+func forwardedValue(v string) string {
+	for _, r := range v {
+		if tools.IsForbiddenChar(r) {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
+
+func appendList(h headers.Headers, key, v string) {
+	if prior, err := h.Get(key); err == nil {
+		v = prior + ", " + v
+	}
+	h.Del(key)
+	h[key] = v
+}
+
+func joinPath(base, p string) string {
+	switch {
+	case base == "" || base == "/":
+		if p == "" {
+			return "/"
+		}
+		return p
+	case p == "" || p == "/":
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(p, "/")
+}
+
+// relay writes resp to w. Bodies of unknown length and bodies followed by
+// trailers are sent in chunks as they come.
+func relay(w *response.Writer, req *request.Request, resp *client.Response) error {
+	for _, v := range resp.SetCookies {
+		err := w.AddSetCookie(v)
+		if err != nil {
+			return err
+		}
+	}
+	connection, _ := resp.Headers.Get("connection")
+	dropped := droppedHeaders(connection)
+	h := headers.NewHeaders()
+	for k, v := range resp.Headers {
+		if !dropped[strings.ToLower(k)] {
+			h[k] = v
+		}
+	}
+	h["Connection"] = "close"
+
+	trailerKeys := []string{}
+	if v, err := resp.Headers.Get("trailer"); err == nil {
+		trailerKeys = headers.SplitList(v)
+	}
+	noBody := req.RequestLine.Method == request.HEAD ||
+		resp.StatusCode == 204 || resp.StatusCode == 304
+	chunked := !noBody && (resp.ContentLength < 0 || len(trailerKeys) > 0)
+	switch {
+	case chunked:
+		h["Transfer-Encoding"] = "chunked"
+		if len(trailerKeys) > 0 {
+			h["Trailer"] = strings.Join(trailerKeys, ", ")
+		}
+	case !noBody:
+		h["Content-Length"] = strconv.FormatInt(resp.ContentLength, 10)
+	default:
+		// la longueur qu'aurait eue la réponse à un GET
+		if cl, err := resp.Headers.Get("content-length"); err == nil {
+			h["Content-Length"] = cl
+		}
+	}
+
+	err := w.WriteStatusLine(tools.StatusCode(resp.StatusCode))
+	if err != nil {
+		return err
+	}
+	err = w.WriteHeaders(h)
+	if err != nil || noBody {
+		return err
+	}
+	if !chunked {
+		_, err = w.WriteBodyFrom(resp.Body)
+		return err
+	}
+
+	buf := make([]byte, tools.ChunkSize)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			_, werr := w.WriteChunkedBody(buf[:n])
+			if werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.WriteChunkedBodyDone()
+	if err != nil {
+		return err
+	}
+	if len(trailerKeys) == 0 {
+		_, err = w.WriteBody([]byte(tools.CRLF))
+		return err
+	}
+	// resp.Trailers n'est rempli qu'une fois le body lu jusqu'au bout
+	t := headers.NewHeaders()
+	t["Trailer"] = strings.Join(trailerKeys, ", ")
+	for _, k := range trailerKeys {
+		if v, err := resp.Trailers.Get(k); err == nil {
+			t[k] = v
+		}
+	}
+	return w.WriteTrailers(t)
+}
+
+func writeError(w *response.Writer, statusCode tools.StatusCode) {
+	body := strconv.Itoa(int(statusCode)) + " " + response.StatusText(statusCode) + "\n"
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+		return
+	}
+	h := response.GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", "text/plain; charset=utf-8")
+	err = w.WriteHeaders(h)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+		return
+	}
+	_, err = w.WriteBody([]byte(body))
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+	}
+}
@@ -0,0 +1,376 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/client"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+// upstreamRequest is what the test upstream received.
+type upstreamRequest struct {
+	method string
+	uri    string
+	host   string
+	header http.Header
+	body   string
+}
+
+func newUpstream(t *testing.T, handler http.HandlerFunc) (*httptest.Server, chan upstreamRequest) {
+	received := make(chan upstreamRequest, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- upstreamRequest{r.Method, r.RequestURI, r.Host, r.Header, string(body)}
+		handler(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, received
+}
+
+func proxyRequest(t *testing.T, p *ReverseProxy, raw string) (*http.Response, string) {
+	req, err := request.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	require.NoError(t, err)
+	req.RemoteAddr = "203.0.113.7:51000"
+	buf := &bytes.Buffer{}
+	p.Handle(&response.Writer{Connection: buf}, req)
+
+	method, _, _ := strings.Cut(raw, " ")
+	httpReq, _ := http.NewRequest(method, "/", nil)
+	resp, err := http.ReadResponse(bufio.NewReader(buf), httpReq)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestReverseProxy(t *testing.T) {
+	upstream, received := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Add("Set-Cookie", "a=1; Path=/")
+		w.Header().Add("Set-Cookie", "b=2; HttpOnly")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"ok":true}`)
+	})
+	p, err := New(upstream.URL + "/base")
+	require.NoError(t, err)
+	p.StripPrefix = "/api"
+
+	// Test: Method, path, headers and body are forwarded
+	resp, body := proxyRequest(t, p, "POST /api/items?x=1 HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: X-Hop\r\n"+
+		"X-Hop: dropped\r\n"+
+		"Proxy-Authorization: Basic Zm9vOmJhcg==\r\n"+
+		"X-Forwarded-For: 198.51.100.1\r\n"+
+		"\r\nhello")
+	got := <-received
+	assert.Equal(t, "POST", got.method)
+	assert.Equal(t, "/base/items?x=1", got.uri)
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), got.host)
+	assert.Equal(t, "hello", got.body)
+	assert.Equal(t, "text/plain", got.header.Get("Content-Type"))
+	assert.Empty(t, got.header.Get("X-Hop"))
+	assert.Empty(t, got.header.Get("Proxy-Authorization"))
+	assert.Equal(t, "198.51.100.1, 203.0.113.7", got.header.Get("X-Forwarded-For"))
+	assert.Equal(t, "example.com", got.header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", got.header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=203.0.113.7;host=example.com;proto=http", got.header.Get("Forwarded"))
+
+	// Test: Status, headers and body are relayed
+	assert.Equal(t, 201, resp.StatusCode)
+	assert.Equal(t, `{"ok":true}`, body)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Keep-Alive"))
+	assert.Equal(t, []string{"a=1; Path=/", "b=2; HttpOnly"}, resp.Header.Values("Set-Cookie"))
+
+	// Test: PreserveHost, IPv6 client over TLS
+	p.PreserveHost = true
+	req, err := request.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET /api HTTP/1.1\r\nHost: example.com:8080\r\n\r\n",
+	)))
+	require.NoError(t, err)
+	req.RemoteAddr = "[2001:db8::1]:443"
+	req.TLS = &tls.ConnectionState{}
+	p.Handle(&response.Writer{Connection: io.Discard}, req)
+	got = <-received
+	assert.Equal(t, "/base", got.uri)
+	assert.Equal(t, "example.com:8080", got.host)
+	assert.Equal(t, `for="[2001:db8::1]";host="example.com:8080";proto=https`, got.header.Get("Forwarded"))
+	assert.Equal(t, "https", got.header.Get("X-Forwarded-Proto"))
+}
+
+// rawUpstream answers every connection with raw, whatever the request.
+func rawUpstream(t *testing.T, raw string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				request.ReadRequest(bufio.NewReader(conn))
+				io.WriteString(conn, raw)
+			}()
+		}
+	}()
+	return "http://" + l.Addr().String()
+}
+
+func TestReverseProxyConnectionOptions(t *testing.T) {
+	upstream := rawUpstream(t, "HTTP/1.1 200 OK\r\n"+
+		"Connection: X-Internal, close\r\n"+
+		"X-Internal: secret\r\n"+
+		"X-Public: visible\r\n"+
+		"Content-Security-Policy: script-src 'self' https: 'unsafe-inline'\r\n"+
+		"\r\nclose-delimited body")
+	p, err := New(upstream)
+	require.NoError(t, err)
+
+	// Test: Fields named by Connection are dropped, the body read to EOF
+	resp, body := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("X-Internal"))
+	assert.Equal(t, "visible", resp.Header.Get("X-Public"))
+	assert.Equal(t, "script-src 'self' https: 'unsafe-inline'", resp.Header.Get("Content-Security-Policy"))
+	assert.Equal(t, "close-delimited body", body)
+}
+
+func TestReverseProxyKeepAlive(t *testing.T) {
+	conns := 0
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	upstream.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns++
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+
+	// Test: Upstream connections are reused between requests
+	for _, path := range []string{"/a", "/b", "/c"} {
+		_, body := proxyRequest(t, p, "GET "+path+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		assert.Equal(t, path, body)
+	}
+	assert.Equal(t, 1, conns)
+}
+
+func TestReverseProxyStreaming(t *testing.T) {
+	upstream, received := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		for _, part := range []string{"one ", "two ", "three"} {
+			io.WriteString(w, part)
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("X-Checksum", "abc123")
+	})
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+
+	// Test: Unknown length and trailers are sent chunked
+	resp, body := proxyRequest(t, p, "GET /stream HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	<-received
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, "one two three", body)
+	assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"))
+
+	// Test: HEAD has no body
+	resp, body = proxyRequest(t, p, "HEAD /stream HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	got := <-received
+	assert.Equal(t, "HEAD", got.method)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "", body)
+}
+
+func TestReverseProxyErrors(t *testing.T) {
+	// Test: Invalid upstreams
+	for _, u := range []string{"ftp://example.com", "/relative", "http://"} {
+		_, err := New(u)
+		assert.Error(t, err, u)
+	}
+
+	// Test: Unreachable upstream
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+	upstream.Close()
+	resp, _ := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 502, resp.StatusCode)
+}
+
+func TestReverseProxyTimeouts(t *testing.T) {
+	upstream, received := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-headers":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		case "/slow-body":
+			io.WriteString(w, "partial")
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	})
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+	p.ResponseHeaderTimeout = 20 * time.Millisecond
+
+	// Test: Response headers too slow
+	resp, _ := proxyRequest(t, p, "GET /slow-headers HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	<-received
+	assert.Equal(t, 504, resp.StatusCode)
+
+	// Test: A slow upload doesn't count in the response header timeout
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\n")
+		for _, c := range "hello" {
+			time.Sleep(15 * time.Millisecond)
+			io.WriteString(pw, string(c))
+		}
+		pw.Close()
+	}()
+	req, err := request.ReadRequest(bufio.NewReader(pr))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	p.Handle(&response.Writer{Connection: buf}, req)
+	resp, err = http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "hello", (<-received).body)
+
+	// Test: Total timeout while streaming, the body is cut short
+	p.Timeout = 50 * time.Millisecond
+	req, err = request.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET /slow-body HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	)))
+	require.NoError(t, err)
+	buf = &bytes.Buffer{}
+	p.Handle(&response.Writer{Connection: buf}, req)
+	<-received
+	resp, err = http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "partial", string(body))
+}
+
+func TestReverseProxyClientGone(t *testing.T) {
+	cancelled := make(chan struct{})
+	upstream, received := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			io.WriteString(w, "partial")
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+		close(cancelled)
+	})
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+
+	// Test: The upstream request is cancelled once the client can't be written to
+	req, err := request.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET /stream HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	)))
+	require.NoError(t, err)
+	peer, conn := net.Pipe()
+	peer.Close()
+	p.Handle(&response.Writer{Connection: conn}, req)
+	<-received
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request not cancelled")
+	}
+
+	// Test: The upstream request is cancelled with the client one
+	cancelled = make(chan struct{})
+	req, err = request.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	)))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	buf := &bytes.Buffer{}
+	p.Handle(&response.Writer{Connection: buf}, req.WithContext(ctx))
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request not cancelled")
+	}
+	assert.Equal(t, 0, buf.Len())
+
+	// Test: A request deadline is answered with a 504
+	cancelled = make(chan struct{})
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err = request.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	)))
+	require.NoError(t, err)
+	buf.Reset()
+	p.Handle(&response.Writer{Connection: buf}, req.WithContext(ctx))
+	<-received
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 504, resp.StatusCode)
+}
+
+func TestReverseProxyConnectTimeout(t *testing.T) {
+	// Test: A dial timeout is a 504, a refused connection a 502
+	p, err := New("http://upstream.invalid")
+	require.NoError(t, err)
+	p.Client = &client.Client{
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}
+		},
+	}
+	resp, _ := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 504, resp.StatusCode)
+
+	p, err = New("http://upstream.invalid")
+	require.NoError(t, err)
+	p.Client = &client.Client{
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+		},
+	}
+	resp, _ = proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 502, resp.StatusCode)
+}
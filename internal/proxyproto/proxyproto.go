@@ -0,0 +1,267 @@
+// Package proxyproto reads the PROXY protocol header (v1 text or v2 binary)
+// that load balancers send before the client data, to know the address of
+// the real client.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout bounds the wait for the header when the Listener has
+// no HeaderTimeout.
+const DefaultHeaderTimeout = 10 * time.Second
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// maxV1Len is the longest v1 header, CRLF included.
+const maxV1Len = 107
+
+var (
+	ErrNoHeader    = errors.New("proxy protocol: header missing")
+	ErrUntrusted   = errors.New("proxy protocol: source not trusted")
+	ErrInvalidHead = errors.New("proxy protocol: invalid header")
+)
+
+// Listener reads the header of the connections it accepts, lazily on their
+// first Read, RemoteAddr or LocalAddr so that a slow client doesn't hold
+// Accept.
+type Listener struct {
+	net.Listener
+	// Required refuses the connections without header, and the ones from
+	// a source outside Trusted. Otherwise they are served with their own
+	// address.
+	Required bool
+	// Trusted are the load balancers allowed to send a header, any source
+	// when empty. The header of other sources isn't read.
+	Trusted []netip.Prefix
+	// HeaderTimeout, DefaultHeaderTimeout when zero.
+	HeaderTimeout time.Duration
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, l: l, br: bufio.NewReader(conn)}, nil
+}
+
+// trusted reports whether the header of a connection from addr may be read.
+func (l *Listener) trusted(addr net.Addr) bool {
+	if len(l.Trusted) == 0 {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		// un client Unix est local
+		return addr.Network() == "unix"
+	}
+	for _, p := range l.Trusted {
+		if p.Contains(ap.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection whose addresses come from the PROXY header when
+// there is one.
+type Conn struct {
+	net.Conn
+	l  *Listener
+	br *bufio.Reader
+
+	once   sync.Once
+	err    error
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(p)
+}
+
+// RemoteAddr is the client according to the header, the peer otherwise.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr is the address the client connected to according to the header.
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) readHeader() {
+	if !c.l.trusted(c.Conn.RemoteAddr()) {
+		if c.l.Required {
+			c.err = ErrUntrusted
+		}
+		return
+	}
+	timeout := c.l.HeaderTimeout
+	if timeout == 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	c.remote, c.local, c.err = readHeader(c.br, c.l.Required)
+	if c.err != nil {
+		c.remote, c.local = nil, nil
+	}
+}
+
+// readHeader parses the header at the start of br. The addresses are nil
+// when the header doesn't carry any (LOCAL, UNKNOWN), or when there is no
+// header and it isn't required.
+func readHeader(br *bufio.Reader, required bool) (net.Addr, net.Addr, error) {
+	start, err := br.Peek(len(v1Prefix))
+	if err != nil && len(start) == 0 {
+		return nil, nil, err
+	}
+	if bytes.Equal(start, v1Prefix) {
+		return readV1(br)
+	}
+	if bytes.HasPrefix(v2Signature, start) {
+		sig, err := br.Peek(len(v2Signature))
+		if err == nil && bytes.Equal(sig, v2Signature) {
+			return readV2(br)
+		}
+	}
+	if required {
+		return nil, nil, ErrNoHeader
+	}
+	return nil, nil, nil
+}
+
+// readV1 parses "PROXY TCP4 src dst sport dport\r\n".
+func readV1(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	line := []byte{}
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1Len {
+			return nil, nil, ErrInvalidHead
+		}
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+	}
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidHead, line)
+	}
+	src, err := v1Addr(fields[2], fields[4], fields[1] == "TCP6")
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := v1Addr(fields[3], fields[5], fields[1] == "TCP6")
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func v1Addr(ip, port string, v6 bool) (net.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is6() != v6 {
+		return nil, fmt.Errorf("%w: address %s", ErrInvalidHead, ip)
+	}
+	// pas de zéros en tête ni de signe dans le port
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, fmt.Errorf("%w: port %s", ErrInvalidHead, port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+}
+
+// readV2 parses the binary header: signature, version and command, family,
+// length, then the addresses and TLVs that are skipped.
+func readV2(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	head := make([]byte, 16)
+	_, err := io.ReadFull(br, head)
+	if err != nil {
+		return nil, nil, err
+	}
+	verCmd, family := head[12], head[13]
+	body := make([]byte, binary.BigEndian.Uint16(head[14:16]))
+	_, err = io.ReadFull(br, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if verCmd>>4 != 2 {
+		return nil, nil, fmt.Errorf("%w: version %d", ErrInvalidHead, verCmd>>4)
+	}
+	switch verCmd & 0xf {
+	case 0:
+		// LOCAL : sonde du load balancer, on garde ses adresses
+		return nil, nil, nil
+	case 1:
+	default:
+		return nil, nil, fmt.Errorf("%w: command %d", ErrInvalidHead, verCmd&0xf)
+	}
+
+	var size int
+	switch family {
+	case 0x11, 0x12:
+		size = 4
+	case 0x21, 0x22:
+		size = 16
+	case 0x31, 0x32:
+		if len(body) < 216 {
+			return nil, nil, ErrInvalidHead
+		}
+		return unixAddr(body[:108]), unixAddr(body[108:216]), nil
+	case 0x00:
+		return nil, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: family %#x", ErrInvalidHead, family)
+	}
+	if len(body) < 2*size+4 {
+		return nil, nil, ErrInvalidHead
+	}
+	srcIP, _ := netip.AddrFromSlice(body[:size])
+	dstIP, _ := netip.AddrFromSlice(body[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(body[2*size:])
+	dstPort := binary.BigEndian.Uint16(body[2*size+2:])
+	if family&0xf == 2 {
+		return net.UDPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort)),
+			net.UDPAddrFromAddrPort(netip.AddrPortFrom(dstIP, dstPort)), nil
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, dstPort)), nil
+}
+
+func unixAddr(b []byte) net.Addr {
+	name, _, _ := bytes.Cut(b, []byte{0})
+	return &net.UnixAddr{Name: string(name), Net: "unix"}
+}
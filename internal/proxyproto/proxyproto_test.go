@@ -0,0 +1,156 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accept sends raw on a new connection to l and returns the accepted end.
+func accept(t *testing.T, l *Listener, raw []byte) net.Conn {
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	_, err = client.Write(raw)
+	require.NoError(t, err)
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func listen(t *testing.T) *Listener {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := &Listener{Listener: inner, HeaderTimeout: time.Second}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func readN(t *testing.T, conn net.Conn, n int) string {
+	b := make([]byte, n)
+	_, err := io.ReadFull(conn, b)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func v2Header(cmd, family byte, body []byte) []byte {
+	h := append([]byte{}, v2Signature...)
+	h = append(h, 0x20|cmd, family)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(body)))
+	return append(h, body...)
+}
+
+func TestV1(t *testing.T) {
+	l := listen(t)
+
+	// Test: TCP4 and TCP6 headers give the addresses
+	conn := accept(t, l, []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51000 443\r\nGET"))
+	assert.Equal(t, "203.0.113.7:51000", conn.RemoteAddr().String())
+	assert.Equal(t, "192.0.2.1:443", conn.LocalAddr().String())
+	assert.Equal(t, "GET", readN(t, conn, 3))
+
+	conn = accept(t, l, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 8080 80\r\nGET"))
+	assert.Equal(t, "[2001:db8::1]:8080", conn.RemoteAddr().String())
+	assert.Equal(t, "GET", readN(t, conn, 3))
+
+	// Test: UNKNOWN keeps the address of the peer
+	conn = accept(t, l, []byte("PROXY UNKNOWN\r\nGET"))
+	assert.Equal(t, "GET", readN(t, conn, 3))
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+
+	// Test: Invalid headers
+	for _, raw := range []string{
+		"PROXY TCP4 203.0.113.7 192.0.2.1 51000\r\n",
+		"PROXY TCP4 2001:db8::1 192.0.2.1 51000 443\r\n",
+		"PROXY TCP4 203.0.113.7 192.0.2.1 051000 443\r\n",
+		"PROXY TCP5 203.0.113.7 192.0.2.1 51000 443\r\n",
+		"PROXY TCP4 203.0.113.7 192.0.2.1 51000 443 " + string(make([]byte, 100)),
+	} {
+		conn = accept(t, l, []byte(raw))
+		_, err := conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, ErrInvalidHead, raw)
+	}
+}
+
+func TestV2(t *testing.T) {
+	l := listen(t)
+
+	// Test: PROXY over IPv4, the TLVs are skipped
+	body := []byte{203, 0, 113, 7, 192, 0, 2, 1}
+	body = binary.BigEndian.AppendUint16(body, 51000)
+	body = binary.BigEndian.AppendUint16(body, 443)
+	body = append(body, 0x04, 0x00, 0x01, 0xff)
+	conn := accept(t, l, append(v2Header(1, 0x11, body), "GET"...))
+	assert.Equal(t, "203.0.113.7:51000", conn.RemoteAddr().String())
+	assert.Equal(t, "192.0.2.1:443", conn.LocalAddr().String())
+	assert.Equal(t, "GET", readN(t, conn, 3))
+
+	// Test: PROXY over IPv6
+	src := netip.MustParseAddr("2001:db8::1").As16()
+	dst := netip.MustParseAddr("2001:db8::2").As16()
+	body = append(src[:], dst[:]...)
+	body = binary.BigEndian.AppendUint16(body, 8080)
+	body = binary.BigEndian.AppendUint16(body, 80)
+	conn = accept(t, l, append(v2Header(1, 0x21, body), "GET"...))
+	assert.Equal(t, "[2001:db8::1]:8080", conn.RemoteAddr().String())
+	assert.Equal(t, "GET", readN(t, conn, 3))
+
+	// Test: LOCAL keeps the address of the peer
+	conn = accept(t, l, append(v2Header(0, 0x00, nil), "GET"...))
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+	assert.Equal(t, "GET", readN(t, conn, 3))
+
+	// Test: Truncated addresses and unknown version
+	conn = accept(t, l, v2Header(1, 0x11, []byte{1, 2, 3}))
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrInvalidHead)
+	raw := v2Header(1, 0x11, make([]byte, 12))
+	raw[12] = 0x11
+	conn = accept(t, l, raw)
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrInvalidHead)
+}
+
+func TestPolicy(t *testing.T) {
+	l := listen(t)
+
+	// Test: Without header, the connection is served as is unless required
+	conn := accept(t, l, []byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(t, "GET / ", readN(t, conn, 6))
+	l.Required = true
+	conn = accept(t, l, []byte("GET / HTTP/1.1\r\n"))
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrNoHeader)
+
+	// Test: The header of an untrusted source isn't read
+	l.Required = false
+	l.Trusted = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	conn = accept(t, l, []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51000 443\r\n"))
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+	assert.Equal(t, "PROXY", readN(t, conn, 5))
+
+	// Test: It is refused when required
+	l.Required = true
+	conn = accept(t, l, []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51000 443\r\n"))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrUntrusted)
+
+	// Test: A trusted source
+	l.Trusted = append(l.Trusted, netip.MustParsePrefix("127.0.0.0/8"))
+	conn = accept(t, l, []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51000 443\r\n"))
+	assert.Equal(t, "203.0.113.7:51000", conn.RemoteAddr().String())
+
+	// Test: A client that sends nothing is cut after HeaderTimeout
+	l.HeaderTimeout = 20 * time.Millisecond
+	conn = accept(t, l, nil)
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
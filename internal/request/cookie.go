@@ -0,0 +1,32 @@
+package request
+
+import (
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/cookie"
+)
+
+// Cookies parses the Cookie header of the request, all its lines.
+func (r *Request) Cookies() []*cookie.Cookie {
+	v, err := r.Headers.Get("cookie")
+	if err != nil {
+		return []*cookie.Cookie{}
+	}
+	// Headers joint les lignes par ", ", ce qu'une valeur de cookie ne
+	// peut pas contenir
+	cookies := []*cookie.Cookie{}
+	for line := range strings.SplitSeq(v, ", ") {
+		cookies = append(cookies, cookie.Parse(line)...)
+	}
+	return cookies
+}
+
+// Cookie returns the first cookie called name.
+func (r *Request) Cookie(name string) (*cookie.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, cookie.ErrNoCookie
+}
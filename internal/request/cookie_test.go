@@ -0,0 +1,58 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/cookie"
+)
+
+func TestCookies(t *testing.T) {
+	// Test: Several pairs, the one without name is skipped
+	r, err := RequestFromReader(strings.NewReader(
+		"GET / HTTP/1.1\r\n" +
+			"Cookie: session=abc123; =orphan; theme=\"dark\";lang=fr\r\n" +
+			"\r\n",
+	))
+	require.NoError(t, err)
+	cookies := r.Cookies()
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc123", cookies[0].Value)
+	assert.Equal(t, "theme", cookies[1].Name)
+	assert.Equal(t, "dark", cookies[1].Value)
+	assert.Equal(t, "lang", cookies[2].Name)
+	assert.Equal(t, "fr", cookies[2].Value)
+
+	// Test: Lookup by name
+	c, err := r.Cookie("lang")
+	require.NoError(t, err)
+	assert.Equal(t, "fr", c.Value)
+	_, err = r.Cookie("orphan")
+	assert.ErrorIs(t, err, cookie.ErrNoCookie)
+
+	// Test: Every Cookie line is read
+	r, err = RequestFromReader(strings.NewReader(
+		"GET / HTTP/1.1\r\n" +
+			"Cookie: session=abc123; theme=dark\r\n" +
+			"Cookie: lang=fr\r\n" +
+			"\r\n",
+	))
+	require.NoError(t, err)
+	cookies = r.Cookies()
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "dark", cookies[1].Value)
+	c, err = r.Cookie("lang")
+	require.NoError(t, err)
+	assert.Equal(t, "fr", c.Value)
+
+	// Test: No Cookie header
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Empty(t, r.Cookies())
+	_, err = r.Cookie("session")
+	assert.ErrorIs(t, err, cookie.ErrNoCookie)
+}
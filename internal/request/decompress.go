@@ -0,0 +1,113 @@
+package request
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content-encoding")
+	ErrBodyTooLarge        = errors.New("decompressed body too large")
+)
+
+// DecompressBody makes the body read through BodyReader and ReadBody come
+// out decoded from the gzip or deflate codings listed in Content-Encoding.
+// Reading fails with ErrBodyTooLarge past maxSize decoded bytes. Nothing is
+// read before the handler asks for the body, and Content-Encoding and
+// Content-Length are removed from Headers as they no longer describe it.
+func (r *Request) DecompressBody(maxSize int64) error {
+	v, err := r.Headers.Get("content-encoding")
+	if err != nil {
+		return nil
+	}
+	codings := []string{}
+	for _, c := range headers.SplitList(v) {
+		c = strings.ToLower(c)
+		switch c {
+		case "identity":
+			continue
+		case "gzip", "x-gzip", "deflate":
+			codings = append(codings, c)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, c)
+		}
+	}
+	if len(codings) == 0 {
+		return nil
+	}
+
+	src := r.BodyReader()
+	// les codages sont listés dans l'ordre où ils ont été appliqués
+	for i := len(codings) - 1; i >= 0; i-- {
+		src = &lazyDecoder{src: src, coding: codings[i]}
+	}
+	r.body = &limitedBody{src: src, remaining: maxSize}
+	r.Body = []byte{}
+	r.Headers.Del("content-encoding")
+	r.Headers.Del("content-length")
+	return nil
+}
+
+// lazyDecoder builds its decoder on the first Read: gzip.NewReader reads the
+// header right away, which would send the 100 Continue too early.
+type lazyDecoder struct {
+	src     io.Reader
+	coding  string
+	decoder io.Reader
+}
+
+func (d *lazyDecoder) Read(p []byte) (int, error) {
+	if d.decoder == nil {
+		decoder, err := newDecoder(d.src, d.coding)
+		if err != nil {
+			return 0, err
+		}
+		d.decoder = decoder
+	}
+	return d.decoder.Read(p)
+}
+
+func newDecoder(src io.Reader, coding string) (io.Reader, error) {
+	if coding != "deflate" {
+		return gzip.NewReader(src)
+	}
+	// deflate doit être du zlib, mais certains clients envoient le flux brut
+	br := bufio.NewReader(src)
+	head, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// limitedBody fails instead of truncating the body past remaining bytes.
+type limitedBody struct {
+	src       io.Reader
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.src.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+func encodedRequest(t *testing.T, encoding string, body []byte) *Request {
+	reader := &tools.ChunkReader{
+		Data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Encoding: " + encoding + "\r\n" +
+			fmt.Sprintf("Content-Length: %d\r\n", len(body)) +
+			"\r\n" +
+			string(body),
+		NumBytesPerRead: 16,
+	}
+	r, err := ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	return r
+}
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "zlib":
+		w = zlib.NewWriter(&b)
+	case "flate":
+		fw, err := flate.NewWriter(&b, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	}
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestDecompressBody(t *testing.T) {
+	payload := []byte(strings.Repeat("agent telemetry line\n", 200))
+
+	// Test: gzip body, decoded on read, hook run lazily
+	r := encodedRequest(t, "gzip", compress(t, "gzip", payload))
+	hooked := false
+	r.OnFirstBodyRead(func() error {
+		hooked = true
+		return nil
+	})
+	require.NoError(t, r.DecompressBody(1<<20))
+	assert.False(t, hooked)
+	_, err := r.Headers.Get("content-length")
+	assert.Error(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.True(t, hooked)
+	assert.Equal(t, payload, body)
+
+	// Test: deflate as zlib, and as a raw stream
+	for _, format := range []string{"zlib", "flate"} {
+		r = encodedRequest(t, "deflate", compress(t, format, payload))
+		require.NoError(t, r.DecompressBody(1<<20))
+		body, err = r.ReadBody()
+		require.NoError(t, err, format)
+		assert.Equal(t, payload, body, format)
+	}
+
+	// Test: Stacked codings are undone in reverse order
+	r = encodedRequest(
+		t, "deflate, identity, gzip",
+		compress(t, "gzip", compress(t, "zlib", payload)),
+	)
+	require.NoError(t, r.DecompressBody(1<<20))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, payload, body)
+
+	// Test: Zip bomb
+	r = encodedRequest(t, "gzip", compress(t, "gzip", make([]byte, 1<<20)))
+	require.NoError(t, r.DecompressBody(1000))
+	body, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Equal(t, 1000, len(body))
+
+	// Test: Unsupported coding
+	r = encodedRequest(t, "br", []byte("whatever"))
+	require.ErrorIs(t, r.DecompressBody(1000), ErrUnsupportedEncoding)
+}
@@ -0,0 +1,178 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+const (
+	DefaultMaxFormFields       = 1000
+	DefaultMaxFormSize   int64 = 10 << 20
+)
+
+var (
+	ErrFormTooLarge  = errors.New("form body too large")
+	ErrTooManyFields = errors.New("too many form fields")
+)
+
+// Values maps a form field to its values, in the order they were sent.
+type Values map[string][]string
+
+func (v Values) Get(key string) string {
+	vs := v[key]
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+func (v Values) Add(key, value string) {
+	v[key] = append(v[key], value)
+}
+
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// FormLimits bounds what ParseFormLimits accepts: MaxFields counts the fields
+// of the query and of the body together, MaxSize is the body size in bytes.
+// A zero limit stands for the default one.
+type FormLimits struct {
+	MaxFields int
+	MaxSize   int64
+}
+
+// Path returns the request target without its query.
+func (r *Request) Path() string {
+	path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Query decodes the query of the request target.
+func (r *Request) Query() (Values, error) {
+	v := Values{}
+	_, err := parseQuery(v, r.rawQuery(), DefaultMaxFormFields)
+	return v, err
+}
+
+func (r *Request) rawQuery() string {
+	_, query, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return query
+}
+
+// ParseForm is ParseFormLimits with the default limits.
+func (r *Request) ParseForm() error {
+	return r.ParseFormLimits(FormLimits{
+		MaxFields: DefaultMaxFormFields,
+		MaxSize:   DefaultMaxFormSize,
+	})
+}
+
+// ParseFormLimits fills PostForm with the fields of an urlencoded POST or PUT
+// body, and Form with those same fields followed by the ones of the
+// query. Calling it again once it succeeded does nothing.
+func (r *Request) ParseFormLimits(limits FormLimits) error {
+	if r.Form != nil {
+		return nil
+	}
+	if limits.MaxFields <= 0 {
+		limits.MaxFields = DefaultMaxFormFields
+	}
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = DefaultMaxFormSize
+	}
+	post := Values{}
+	fields := limits.MaxFields
+
+	if r.hasFormBody() {
+		data, err := r.readBodyLimit(limits.MaxSize)
+		if err != nil {
+			return err
+		}
+		n, err := parseQuery(post, string(data), fields)
+		if err != nil {
+			return err
+		}
+		fields -= n
+	}
+
+	form := Values{}
+	for k, vs := range post {
+		form[k] = append(form[k], vs...)
+	}
+	_, err := parseQuery(form, r.rawQuery(), fields)
+	if err != nil {
+		return err
+	}
+
+	r.PostForm = post
+	r.Form = form
+	return nil
+}
+
+func (r *Request) hasFormBody() bool {
+	switch r.RequestLine.Method {
+	case POST, PUT:
+	default:
+		return false
+	}
+	ct, err := r.Headers.Get("content-type")
+	if err != nil {
+		return false
+	}
+	mediaType, _, err := headers.ParseMediaType(ct)
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// readBodyLimit reads the whole body into Body, failing with
+// ErrFormTooLarge past max bytes.
+func (r *Request) readBodyLimit(max int64) ([]byte, error) {
+	if r.body == nil {
+		if int64(len(r.Body)) > max {
+			return nil, ErrFormTooLarge
+		}
+		return r.Body, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.body, max+1-int64(len(r.Body))))
+	r.Body = append(r.Body, data...)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(r.Body)) > max {
+		return nil, ErrFormTooLarge
+	}
+	r.body = nil
+	return r.Body, nil
+}
+
+// parseQuery adds the fields of an urlencoded string to dst and returns how
+// many it found.
+func parseQuery(dst Values, query string, maxFields int) (int, error) {
+	n := 0
+	for field := range strings.SplitSeq(query, "&") {
+		if field == "" {
+			continue
+		}
+		if n >= maxFields {
+			return n, ErrTooManyFields
+		}
+		k, v, _ := strings.Cut(field, "=")
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			return n, fmt.Errorf("invalid form key %q: %w", k, err)
+		}
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			return n, fmt.Errorf("invalid form value %q: %w", v, err)
+		}
+		dst.Add(key, value)
+		n++
+	}
+	return n, nil
+}
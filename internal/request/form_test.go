@@ -0,0 +1,94 @@
+package request
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+func TestParseForm(t *testing.T) {
+	// Test: Body and query are merged, body first
+	reader := &tools.ChunkReader{
+		Data: "POST /submit?name=query&page=2 HTTP/1.1\r\n" +
+			"Content-Type: application/x-www-form-urlencoded; charset=utf-8\r\n" +
+			"Content-Length: 36\r\n" +
+			"\r\n" +
+			"name=lane&tag=go&tag=http+tcp&empty=",
+		NumBytesPerRead: 5,
+	}
+	r, err := ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "/submit", r.Path())
+	assert.Equal(t, []string{"lane", "query"}, r.Form["name"])
+	assert.Equal(t, []string{"go", "http tcp"}, r.Form["tag"])
+	assert.Equal(t, "2", r.Form.Get("page"))
+	assert.True(t, r.Form.Has("empty"))
+	assert.Equal(t, "lane", r.PostForm.Get("name"))
+	assert.False(t, r.PostForm.Has("page"))
+	assert.Equal(t, "name=lane&tag=go&tag=http+tcp&empty=", string(r.Body))
+
+	// Test: GET only reads the query
+	r, err = RequestFromReader(strings.NewReader(
+		"GET /search?q=%C3%A9t%C3%A9 HTTP/1.1\r\n\r\n",
+	))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "été", r.Form.Get("q"))
+	assert.Equal(t, 0, len(r.PostForm))
+
+	// Test: Body larger than the limit
+	reader = &tools.ChunkReader{
+		Data: "POST / HTTP/1.1\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 11\r\n" +
+			"\r\n" +
+			"a=1&b=2&c=3",
+		NumBytesPerRead: 4,
+	}
+	r, err = ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	err = r.ParseFormLimits(FormLimits{MaxFields: 10, MaxSize: 8})
+	require.ErrorIs(t, err, ErrFormTooLarge)
+
+	// Test: Too many fields across body and query
+	reader = &tools.ChunkReader{
+		Data: "POST /?d=4 HTTP/1.1\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 11\r\n" +
+			"\r\n" +
+			"a=1&b=2&c=3",
+		NumBytesPerRead: 4,
+	}
+	r, err = ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	err = r.ParseFormLimits(FormLimits{MaxFields: 3, MaxSize: 64})
+	require.ErrorIs(t, err, ErrTooManyFields)
+
+	// Test: Zero limits are the default ones
+	reader = &tools.ChunkReader{
+		Data: "POST /?d=4 HTTP/1.1\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 11\r\n" +
+			"\r\n" +
+			"a=1&b=2&c=3",
+		NumBytesPerRead: 4,
+	}
+	r, err = ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseFormLimits(FormLimits{}))
+	assert.Equal(t, "3", r.PostForm.Get("c"))
+	assert.Equal(t, "4", r.Form.Get("d"))
+
+	// Test: Invalid escape
+	r, err = RequestFromReader(strings.NewReader(
+		"GET /?q=%zz HTTP/1.1\r\n\r\n",
+	))
+	require.NoError(t, err)
+	require.Error(t, r.ParseForm())
+}
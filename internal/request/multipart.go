@@ -0,0 +1,453 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+const multipartBufferSize = 64 * 1024
+
+var (
+	ErrNotMultipart    = errors.New("request is not multipart/form-data")
+	ErrMessageTooLarge = errors.New("multipart message too large")
+)
+
+// MultipartReader streams the parts of a multipart body, one at a time.
+type MultipartReader struct {
+	br             *bufio.Reader
+	dashBoundary   []byte // "--boundary"
+	nlDashBoundary []byte // "\r\n--boundary"
+	current        *Part
+	partsRead      int
+	done           bool
+}
+
+// Part is one part of a multipart body. Reading it yields its content,
+// it stops at the next boundary.
+type Part struct {
+	Headers headers.Headers
+
+	mr          *MultipartReader
+	disposition string
+	params      map[string]string
+	eof         bool
+}
+
+// NewMultipartReader reads the parts of r separated by boundary.
+func NewMultipartReader(r io.Reader, boundary string) *MultipartReader {
+	return &MultipartReader{
+		br:             bufio.NewReaderSize(r, multipartBufferSize),
+		dashBoundary:   []byte("--" + boundary),
+		nlDashBoundary: []byte("\r\n--" + boundary),
+	}
+}
+
+// MultipartReader returns a reader over the body of a multipart/form-data
+// request, the boundary comes from the Content-Type header.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+	ct, err := r.Headers.Get("content-type")
+	if err != nil {
+		return nil, ErrNotMultipart
+	}
+	mediaType, params, err := headers.ParseMediaType(ct)
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" || len(boundary) > 70 {
+		return nil, fmt.Errorf("invalid multipart boundary: %q", boundary)
+	}
+	return NewMultipartReader(r.BodyReader(), boundary), nil
+}
+
+// NextPart skips what is left of the current part and returns the next one,
+// or io.EOF after the closing boundary.
+func (mr *MultipartReader) NextPart() (*Part, error) {
+	if mr.current != nil {
+		_, err := io.Copy(io.Discard, mr.current)
+		if err != nil {
+			return nil, err
+		}
+		mr.current = nil
+	}
+	if mr.done {
+		return nil, io.EOF
+	}
+
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) && mr.partsRead == 0 {
+			continue // longue ligne de préambule
+		}
+		if mr.isFinalBoundary(line) {
+			mr.done = true
+			return nil, io.EOF
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if mr.isBoundary(line) {
+			break
+		}
+		if mr.partsRead > 0 {
+			return nil, fmt.Errorf("expected multipart boundary, got %q", line)
+		}
+	}
+
+	h, err := readPartHeaders(mr.br)
+	if err != nil {
+		return nil, err
+	}
+	p := &Part{Headers: h, mr: mr}
+	if cd, err := h.Get("content-disposition"); err == nil {
+		p.disposition, p.params, _ = headers.ParseMediaType(cd)
+	}
+	mr.partsRead++
+	mr.current = p
+	return p, nil
+}
+
+// isBoundary matches "--boundary" followed by optional whitespace.
+func (mr *MultipartReader) isBoundary(line []byte) bool {
+	rest, ok := bytes.CutPrefix(line, mr.dashBoundary)
+	return ok && len(bytes.TrimRight(rest, " \t\r\n")) == 0
+}
+
+// isFinalBoundary matches "--boundary--" followed by optional whitespace.
+func (mr *MultipartReader) isFinalBoundary(line []byte) bool {
+	rest, ok := bytes.CutPrefix(line, mr.dashBoundary)
+	if !ok {
+		return false
+	}
+	rest, ok = bytes.CutPrefix(rest, []byte("--"))
+	return ok && len(bytes.TrimRight(rest, " \t\r\n")) == 0
+}
+
+func readPartHeaders(br *bufio.Reader) (headers.Headers, error) {
+	h := headers.NewHeaders()
+	need := 1
+	for {
+		data, err := br.Peek(max(need, br.Buffered()))
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				return nil, ErrMessageTooLarge
+			}
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		n, done, err := h.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			need = len(data) + 1
+			continue
+		}
+		br.Discard(n)
+		need = 1
+		if done {
+			return h, nil
+		}
+	}
+}
+
+// Read reads the content of the part. The "\r\n" before the next boundary
+// belongs to the delimiter, not to the content.
+func (p *Part) Read(b []byte) (int, error) {
+	if p.eof {
+		return 0, io.EOF
+	}
+	mr := p.mr
+	nl := mr.nlDashBoundary
+	peek, err := mr.br.Peek(max(len(nl), mr.br.Buffered()))
+	if idx := bytes.Index(peek, nl); idx >= 0 {
+		if idx == 0 {
+			// on laisse "--boundary" pour NextPart
+			mr.br.Discard(2)
+			p.eof = true
+			return 0, io.EOF
+		}
+		n := copy(b, peek[:idx])
+		mr.br.Discard(n)
+		return n, nil
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	// the tail could be the start of the delimiter, keep it for later
+	n := copy(b, peek[:len(peek)-len(nl)+1])
+	mr.br.Discard(n)
+	return n, nil
+}
+
+// FormName returns the name parameter of a form-data Content-Disposition.
+func (p *Part) FormName() string {
+	if p.disposition != "form-data" {
+		return ""
+	}
+	return p.params["name"]
+}
+
+// FileName returns the filename parameter of the Content-Disposition,
+// stripped of any directory.
+func (p *Part) FileName() string {
+	name := p.params["filename"]
+	if name == "" {
+		return ""
+	}
+	return filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+}
+
+// ContentType returns the Content-Type of the part, text/plain by default.
+func (p *Part) ContentType() string {
+	ct, err := p.Headers.Get("content-type")
+	if err != nil {
+		return "text/plain"
+	}
+	return ct
+}
+
+// MultipartLimits bounds what ParseMultipartFormLimits keeps in memory.
+// File contents beyond MaxMemory bytes, across all files, are written to
+// temporary files in TempDir (os.TempDir when empty): with 0 they all are.
+// A zero MaxParts or MaxValueSize stands for the default limit.
+type MultipartLimits struct {
+	MaxMemory    int64
+	MaxParts     int
+	MaxValueSize int64
+	TempDir      string
+}
+
+// MultipartForm holds a parsed multipart/form-data body.
+type MultipartForm struct {
+	Value Values
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes an uploaded file, Open gives its content back
+// whether it was kept in memory or spilled to disk.
+type FileHeader struct {
+	Filename string
+	Headers  headers.Headers
+	Size     int64
+
+	content []byte
+	tmpfile string
+}
+
+// File is the content of an uploaded file.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func (fh *FileHeader) Open() (File, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return memFile{bytes.NewReader(fh.content)}, nil
+}
+
+// RemoveAll deletes the temporary files of the form.
+func (f *MultipartForm) RemoveAll() error {
+	var errs []error
+	for _, fhs := range f.File {
+		for _, fh := range fhs {
+			if fh.tmpfile == "" {
+				continue
+			}
+			err := os.Remove(fh.tmpfile)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tempForms lists the multipart forms parsed on a request, for their files.
+// The copies made by WithContext share it, so that the files are removed
+// whichever copy parsed the form.
+type tempForms struct {
+	mu    sync.Mutex
+	forms []*MultipartForm
+}
+
+// RemoveTempFiles deletes the temporary files of the multipart forms parsed
+// on r or on its copies. The server calls it once the handler returned.
+func (r *Request) RemoveTempFiles() error {
+	if r.tempForms == nil {
+		return nil
+	}
+	r.tempForms.mu.Lock()
+	defer r.tempForms.mu.Unlock()
+	var errs []error
+	for _, f := range r.tempForms.forms {
+		errs = append(errs, f.RemoveAll())
+	}
+	r.tempForms.forms = nil
+	return errors.Join(errs...)
+}
+
+// ParseMultipartForm is ParseMultipartFormLimits with maxMemory and the
+// default form limits. A maxMemory of 0 writes every file to disk.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	return r.ParseMultipartFormLimits(MultipartLimits{
+		MaxMemory:    maxMemory,
+		MaxParts:     DefaultMaxFormFields,
+		MaxValueSize: DefaultMaxFormSize,
+	})
+}
+
+// ParseMultipartFormLimits reads a multipart/form-data body into
+// MultipartForm. Its fields also go to PostForm and, followed by the ones of
+// the query, to Form. The temporary files belong to the request: the server
+// removes them after the handler, whichever copy of the request parsed the
+// form. Without a server, call RemoveTempFiles.
+func (r *Request) ParseMultipartFormLimits(limits MultipartLimits) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	if limits.MaxParts <= 0 {
+		limits.MaxParts = DefaultMaxFormFields
+	}
+	if limits.MaxValueSize <= 0 {
+		limits.MaxValueSize = DefaultMaxFormSize
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	form := &MultipartForm{
+		Value: Values{},
+		File:  map[string][]*FileHeader{},
+	}
+	err = form.read(mr, limits)
+	if err != nil {
+		form.RemoveAll()
+		return err
+	}
+	r.MultipartForm = form
+	if r.tempForms == nil {
+		r.tempForms = &tempForms{}
+	}
+	r.tempForms.mu.Lock()
+	r.tempForms.forms = append(r.tempForms.forms, form)
+	r.tempForms.mu.Unlock()
+
+	all := Values{}
+	for k, vs := range form.Value {
+		all[k] = append(all[k], vs...)
+	}
+	_, err = parseQuery(all, r.rawQuery(), DefaultMaxFormFields)
+	if err != nil {
+		return err
+	}
+	r.PostForm = form.Value
+	r.Form = all
+	return nil
+}
+
+func (f *MultipartForm) read(mr *MultipartReader, limits MultipartLimits) error {
+	memory := limits.MaxMemory
+	valueSize := limits.MaxValueSize
+	parts := 0
+
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		parts++
+		if parts > limits.MaxParts {
+			return ErrTooManyFields
+		}
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		filename := p.FileName()
+		if filename == "" {
+			var b bytes.Buffer
+			n, err := io.CopyN(&b, p, valueSize+1)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			valueSize -= n
+			if valueSize < 0 {
+				return ErrMessageTooLarge
+			}
+			f.Value.Add(name, b.String())
+			continue
+		}
+
+		fh := &FileHeader{Filename: filename, Headers: p.Headers}
+		var b bytes.Buffer
+		n, err := io.CopyN(&b, p, max(memory, 0)+1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if n > memory {
+			err = fh.spill(limits.TempDir, &b, p)
+			if err != nil {
+				return err
+			}
+		} else {
+			fh.content = b.Bytes()
+			fh.Size = n
+			memory -= n
+		}
+		f.File[name] = append(f.File[name], fh)
+	}
+}
+
+// spill writes what was already buffered and the rest of the part to a
+// temporary file.
+func (fh *FileHeader) spill(dir string, buffered io.Reader, rest io.Reader) error {
+	file, err := os.CreateTemp(dir, "multipart-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fh.tmpfile = file.Name()
+	n, err := io.Copy(file, io.MultiReader(buffered, rest))
+	if err != nil {
+		os.Remove(fh.tmpfile)
+		fh.tmpfile = ""
+		return err
+	}
+	fh.Size = n
+	return nil
+}
@@ -0,0 +1,167 @@
+package request
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+func multipartRequest(t *testing.T, body string, numBytesPerRead int) *Request {
+	reader := &tools.ChunkReader{
+		Data: "POST /upload?source=test HTTP/1.1\r\n" +
+			"Content-Type: multipart/form-data; boundary=\"xYzZY\"\r\n" +
+			fmt.Sprintf("Content-Length: %d\r\n", len(body)) +
+			"\r\n" +
+			body,
+		NumBytesPerRead: numBytesPerRead,
+	}
+	r, err := ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	return r
+}
+
+const multipartBody = "preamble is ignored\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"my vacation\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"photo\"; filename=\"C:\\\\pics\\\\beach.jpg\"\r\n" +
+	"Content-Type: image/jpeg\r\n" +
+	"\r\n" +
+	"not really a jpeg\r\n--xYz but close\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"notes\"; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"0123456789abcdef\r\n" +
+	"--xYzZY--\r\n" +
+	"epilogue"
+
+func TestMultipartReader(t *testing.T) {
+	// Test: Parts are streamed with their headers
+	r := multipartRequest(t, multipartBody, 3)
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+
+	p, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", p.FormName())
+	assert.Equal(t, "", p.FileName())
+	assert.Equal(t, "text/plain", p.ContentType())
+	data, err := io.ReadAll(p)
+	require.NoError(t, err)
+	assert.Equal(t, "my vacation", string(data))
+
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "photo", p.FormName())
+	assert.Equal(t, "beach.jpg", p.FileName())
+	assert.Equal(t, "image/jpeg", p.ContentType())
+	data, err = io.ReadAll(p)
+	require.NoError(t, err)
+	assert.Equal(t, "not really a jpeg\r\n--xYz but close", string(data))
+
+	// unread parts are skipped
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", p.FileName())
+	_, err = mr.NextPart()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Missing closing boundary
+	r = multipartRequest(t, "--xYzZY\r\n\r\ntruncated", 4)
+	mr, err = r.MultipartReader()
+	require.NoError(t, err)
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	_, err = io.ReadAll(p)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Not a multipart request
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.MultipartReader()
+	require.ErrorIs(t, err, ErrNotMultipart)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	// Test: Small files stay in memory, the others go to disk
+	dir := t.TempDir()
+	r := multipartRequest(t, multipartBody, 7)
+	err := r.ParseMultipartFormLimits(MultipartLimits{
+		MaxMemory:    40,
+		MaxParts:     10,
+		MaxValueSize: 1024,
+		TempDir:      dir,
+	})
+	require.NoError(t, err)
+	form := r.MultipartForm
+	assert.Equal(t, "my vacation", form.Value.Get("title"))
+	assert.Equal(t, "my vacation", r.PostForm.Get("title"))
+	assert.Equal(t, "test", r.Form.Get("source"))
+
+	photo := form.File["photo"][0]
+	assert.Equal(t, "beach.jpg", photo.Filename)
+	assert.Equal(t, int64(34), photo.Size)
+	assert.Equal(t, "", photo.tmpfile)
+
+	notes := form.File["notes"][0]
+	assert.Equal(t, int64(16), notes.Size)
+	assert.NotEqual(t, "", notes.tmpfile)
+	f, err := notes.Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "0123456789abcdef", string(data))
+
+	require.NoError(t, form.RemoveAll())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	// Test: Zero limits are the default ones, files all go to disk
+	r = multipartRequest(t, multipartBody, 7)
+	err = r.ParseMultipartFormLimits(MultipartLimits{TempDir: dir})
+	require.NoError(t, err)
+	assert.Equal(t, "my vacation", r.MultipartForm.Value.Get("title"))
+	assert.NotEqual(t, "", r.MultipartForm.File["photo"][0].tmpfile)
+	assert.NotEqual(t, "", r.MultipartForm.File["notes"][0].tmpfile)
+	require.NoError(t, r.MultipartForm.RemoveAll())
+
+	// Test: A copy parses the form, removing the files of the original does
+	r = multipartRequest(t, multipartBody, 7)
+	err = r.WithContext(t.Context()).ParseMultipartFormLimits(MultipartLimits{TempDir: dir})
+	require.NoError(t, err)
+	assert.Nil(t, r.MultipartForm)
+	require.NoError(t, r.RemoveTempFiles())
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	// Test: Too many parts
+	r = multipartRequest(t, multipartBody, 7)
+	err = r.ParseMultipartFormLimits(MultipartLimits{
+		MaxMemory:    1024,
+		MaxParts:     2,
+		MaxValueSize: 1024,
+	})
+	require.ErrorIs(t, err, ErrTooManyFields)
+
+	// Test: Values larger than the limit
+	r = multipartRequest(t, multipartBody, 7)
+	err = r.ParseMultipartFormLimits(MultipartLimits{
+		MaxMemory:    1024,
+		MaxParts:     10,
+		MaxValueSize: 4,
+	})
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+}
@@ -1,12 +1,16 @@
 package request
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
@@ -15,10 +19,13 @@ import (
 type ParseState int
 
 const (
-	GET    = "GET"
-	POST   = "POST"
-	DELETE = "DELETE"
-	PUT    = "PUT"
+	GET     = "GET"
+	HEAD    = "HEAD"
+	POST    = "POST"
+	DELETE  = "DELETE"
+	PUT     = "PUT"
+	PATCH   = "PATCH"
+	OPTIONS = "OPTIONS"
 )
 
 const (
@@ -30,18 +37,50 @@ const (
 
 const bufferSize = 8
 
+var ErrHeadTooLarge = errors.New("request head too large")
+
 type Request struct {
 	RequestLine RequestLine
 	State       ParseState
 	Headers     headers.Headers
 	Body        []byte
+
+	// Form and PostForm are filled by ParseForm or ParseMultipartForm,
+	// MultipartForm by the latter.
+	Form          Values
+	PostForm      Values
+	MultipartForm *MultipartForm
+
+	// RemoteAddr is the address of the client and LocalAddr the one it
+	// connected to, set by the server like the fields below.
+	RemoteAddr string
+	LocalAddr  string
+	// TLS is the state of the connection once the handshake is done, nil
+	// over plain TCP.
+	TLS *tls.ConnectionState
+	// ConnID identifies the connection among the ones of the server. Seq is
+	// meant to be the rank of the request on it, but the server reads one
+	// request per connection for now: it is always 1.
+	ConnID uint64
+	Seq    int
+	// ReceivedAt is when the request line and the headers were read.
+	ReceivedAt time.Time
+
+	ctx       context.Context
+	tempForms *tempForms
+
+	// body is the part of the payload still on the wire when the request
+	// comes from ReadRequest, nil once it has been read into Body.
+	body        io.Reader
+	onFirstRead func() error
 }
 
 func NewRequest() *Request {
 	return &Request{
-		State:   parseInitialized,
-		Headers: headers.NewHeaders(),
-		Body:    make([]byte, 0),
+		State:     parseInitialized,
+		Headers:   headers.NewHeaders(),
+		Body:      make([]byte, 0),
+		tempForms: &tempForms{},
 	}
 }
 
@@ -118,6 +157,135 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 	return request, nil
 }
 
+// ReadRequest parses the request-line and the headers from br and stops
+// there: the body stays on the wire until the handler asks for it through
+// BodyReader or ReadBody. The head must fit in the buffer of br.
+func ReadRequest(br *bufio.Reader) (*Request, error) {
+	request := NewRequest()
+	need := 1
+
+	for request.State == parseInitialized || request.State == parseHeaders {
+		data, err := br.Peek(max(need, br.Buffered()))
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				return nil, ErrHeadTooLarge
+			}
+			if errors.Is(err, io.EOF) && len(data) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		n, err := request.parse(data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			need = len(data) + 1
+			continue
+		}
+		br.Discard(n)
+		need = 1
+	}
+
+	if request.State == parseBody {
+		cl, _ := request.Headers.Get("content-length")
+		l, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || l < 0 {
+			return nil, fmt.Errorf("invalid content-length: %s", cl)
+		}
+		request.body = &body{req: request, src: br, remaining: l}
+	}
+	return request, nil
+}
+
+// body streams a payload delimited by Content-Length.
+type body struct {
+	req       *Request
+	src       io.Reader
+	remaining int64
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		b.req.State = parseDone
+		return 0, io.EOF
+	}
+	if fn := b.req.onFirstRead; fn != nil {
+		b.req.onFirstRead = nil
+		if err := fn(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.src.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining == 0 {
+		b.req.State = parseDone
+	} else if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// BodyReader returns the body of the request as a stream. For a request
+// parsed with RequestFromReader it simply reads Body.
+func (r *Request) BodyReader() io.Reader {
+	if r.body == nil {
+		return bytes.NewReader(r.Body)
+	}
+	return r.body
+}
+
+// ReadBody reads what is left of the body into Body and returns it.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.body == nil {
+		return r.Body, nil
+	}
+	b, err := io.ReadAll(r.body)
+	r.Body = append(r.Body, b...)
+	if err != nil {
+		return r.Body, err
+	}
+	r.body = nil
+	return r.Body, nil
+}
+
+// ExpectContinue reports whether the client sent "Expect: 100-continue" and
+// waits for an interim response before sending the body.
+func (r *Request) ExpectContinue() bool {
+	v, err := r.Headers.Get("expect")
+	return err == nil && strings.EqualFold(v, "100-continue")
+}
+
+// OnFirstBodyRead registers fn to run once, right before the first byte of
+// the body is read from the wire. It is a no-op for a request without body.
+func (r *Request) OnFirstBodyRead(fn func() error) {
+	r.onFirstRead = fn
+}
+
+// Context returns the context of the request. The server cancels it once
+// the client is gone, the server stops, the request timeout expires or the
+// handler returned. Middleware adds values to it with WithContext.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r with ctx as its context. The
+// copy takes over the body still on the wire.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	if b, ok := r.body.(*body); ok {
+		b.req = &r2
+	}
+	return &r2
+}
+
 func (r *Request) parse(data []byte) (int, error) {
 	switch r.State {
 	case parseInitialized:
@@ -180,7 +348,9 @@ func requestLineFromString(request string) (*RequestLine, error) {
 		)
 	}
 	method := parts[0]
-	if method != GET && method != POST && method != PUT && method != DELETE {
+	switch method {
+	case GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS:
+	default:
 		return nil, fmt.Errorf("invalid method: %s", method)
 	}
 	target := parts[1]
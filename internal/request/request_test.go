@@ -1,6 +1,8 @@
 package request
 
 import (
+	"bufio"
+	"io"
 	"strings"
 	"testing"
 
@@ -215,3 +217,72 @@ func TestBodyParse(t *testing.T) {
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestReadRequest(t *testing.T) {
+	// Test: Body is left on the wire until read
+	reader := &tools.ChunkReader{
+		Data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n" +
+			"GET / HTTP/1.1\r\n\r\n",
+		NumBytesPerRead: 3,
+	}
+	br := bufio.NewReader(reader)
+	r, err := ReadRequest(br)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "POST", r.RequestLine.Method)
+	assert.Equal(t, 0, len(r.Body))
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Equal(t, parseDone, r.State)
+	// the next request is still buffered
+	r, err = ReadRequest(br)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+
+	// Test: Expect 100-continue hook runs once, on first read
+	reader = &tools.ChunkReader{
+		Data: "PUT /upload HTTP/1.1\r\n" +
+			"Expect: 100-continue\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		NumBytesPerRead: 2,
+	}
+	r, err = ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	assert.True(t, r.ExpectContinue())
+	calls := 0
+	r.OnFirstBodyRead(func() error {
+		calls++
+		return nil
+	})
+	assert.Equal(t, 0, calls)
+	body, err = io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, 1, calls)
+
+	// Test: Body shorter than reported content length
+	reader = &tools.ChunkReader{
+		Data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		NumBytesPerRead: 3,
+	}
+	r, err = ReadRequest(bufio.NewReader(reader))
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Head larger than the buffer
+	_, err = ReadRequest(bufio.NewReaderSize(strings.NewReader(
+		"GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 64)+"\r\n\r\n",
+	), 16))
+	require.ErrorIs(t, err, ErrHeadTooLarge)
+}
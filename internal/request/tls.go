@@ -0,0 +1,33 @@
+package request
+
+import "crypto/x509"
+
+// VerifiedChain returns the client certificate followed by its issuers up
+// to the trusted CA, as verified during the handshake. It is nil over plain
+// TCP and when the client sent no certificate.
+func (r *Request) VerifiedChain() []*x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0]
+}
+
+// ClientCertificate returns the verified certificate of the client, nil
+// when there is none.
+func (r *Request) ClientCertificate() *x509.Certificate {
+	chain := r.VerifiedChain()
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain[0]
+}
+
+// ClientSubject returns the distinguished name of the verified client
+// certificate, "" when there is none.
+func (r *Request) ClientSubject() string {
+	cert := r.ClientCertificate()
+	if cert == nil {
+		return ""
+	}
+	return cert.Subject.String()
+}
@@ -0,0 +1,155 @@
+package response
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// minCompressSize is the Content-Length under which compressing isn't worth
+// the chunked framing.
+const minCompressSize = 256
+
+var compressibleTypes = map[string]struct{}{
+	"application/json":       {},
+	"application/javascript": {},
+	"application/xml":        {},
+	"application/wasm":       {},
+	"image/svg+xml":          {},
+}
+
+// EnableCompression lets the writer compress the body with gzip or deflate
+// when the Accept-Encoding of req allows it and the Content-Type given to
+// WriteHeaders is compressible. Close must be called once the body is
+// written.
+func (w *Writer) EnableCompression(req headers.Headers) {
+	w.acceptEncoding = req.AcceptEncoding()
+	_, err := req.Get("accept-encoding")
+	w.compress = err == nil
+}
+
+// Flush pushes what the compressor holds to the connection, as a chunk.
+func (w *Writer) Flush() error {
+	if w.compressor == nil {
+		return nil
+	}
+	f, ok := w.compressor.(interface{ Flush() error })
+	if !ok {
+		return nil
+	}
+	return f.Flush()
+}
+
+// Close ends a compressed body: it flushes the compressor and writes the
+// last chunk. It does nothing for other responses.
+func (w *Writer) Close() error {
+	if w.compressor == nil {
+		return nil
+	}
+	err := w.compressor.Close()
+	w.compressor = nil
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w.Connection, "%X%s%s", 0, tools.CRLF, tools.CRLF)
+	return err
+}
+
+// setupCompression decides, from the final headers of the response,
+// whether the body gets compressed. It returns the headers to send.
+func (w *Writer) setupCompression(h headers.Headers) headers.Headers {
+	if !w.compress || !compressible(w.statusCode, h) {
+		return h
+	}
+
+	out := headers.NewHeaders()
+	for k, v := range h {
+		out[k] = v
+	}
+	out.Set("Vary", "Accept-Encoding")
+
+	encoding := ""
+	q := 0.0
+	for _, e := range []string{"gzip", "deflate"} {
+		if eq := encodingQ(w.acceptEncoding, e); eq > q {
+			encoding, q = e, eq
+		}
+	}
+	if encoding == "" {
+		return out
+	}
+
+	cw := &chunkedWriter{w: w}
+	switch encoding {
+	case "gzip":
+		w.compressor = gzip.NewWriter(cw)
+	case "deflate":
+		// "deflate" dans HTTP c'est le flux flate dans une enveloppe zlib
+		w.compressor = zlib.NewWriter(cw)
+	}
+	out.Del("Content-Length")
+	out.Replace("Transfer-Encoding", "chunked")
+	out.Replace("Content-Encoding", encoding)
+	// les octets changent avec l'encodage, le validateur n'est plus fort
+	if v, err := out.Get("etag"); err == nil {
+		if tag, ok := headers.ParseETag(v); ok && !tag.Weak {
+			tag.Weak = true
+			out.Replace("ETag", tag.String())
+		}
+	}
+	return out
+}
+
+func compressible(statusCode tools.StatusCode, h headers.Headers) bool {
+	if statusCode == 204 || statusCode == 304 ||
+		statusCode == StatusPartialContent ||
+		statusCode == StatusRangeNotSatisfiable {
+		// les Content-Range portent sur le contenu non compressé
+		return false
+	}
+	if _, err := h.Get("content-encoding"); err == nil {
+		return false
+	}
+	if _, err := h.Get("transfer-encoding"); err == nil {
+		// le handler fait déjà son propre découpage en chunks
+		return false
+	}
+	if cl, err := h.Get("content-length"); err == nil {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < minCompressSize {
+			return false
+		}
+	}
+	ct, _, ok := h.ContentType()
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(ct, "text/") ||
+		strings.HasSuffix(ct, "+json") ||
+		strings.HasSuffix(ct, "+xml") {
+		return true
+	}
+	_, ok = compressibleTypes[ct]
+	return ok
+}
+
+// chunkedWriter frames each write as one chunk.
+type chunkedWriter struct {
+	w *Writer
+}
+
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	_, err := cw.w.writeChunk(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+var page = strings.Repeat("<p>Your request was an absolute banger.</p>\n", 50)
+
+func writePage(t *testing.T, acceptEncoding, contentType string) *http.Response {
+	buf := &bytes.Buffer{}
+	w := &Writer{Connection: buf}
+	w.EnableCompression(requestHeaders(t, acceptEncoding))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(page)))
+	require.NoError(t, w.WriteHeaders(h))
+	// en plusieurs morceaux pour avoir plusieurs chunks
+	_, err := w.WriteBody([]byte(page[:100]))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	_, err = w.WriteBody([]byte(page[100:]))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestCompression(t *testing.T) {
+	// Test: gzip preferred
+	resp := writePage(t, "Accept-Encoding: deflate, gzip\r\n", "text/html; charset=utf-8")
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: deflate when gzip is refused
+	resp = writePage(t, "Accept-Encoding: gzip;q=0, deflate\r\n", "application/json")
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+	zlr, err := zlib.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(zlr)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: Already compressed types are left alone
+	resp = writePage(t, "Accept-Encoding: gzip\r\n", "video/mp4")
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", resp.Header.Get("Vary"))
+	assert.Equal(t, int64(len(page)), resp.ContentLength)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: Client without gzip nor deflate still gets Vary
+	resp = writePage(t, "Accept-Encoding: br\r\n", "text/plain")
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, int64(len(page)), resp.ContentLength)
+}
+
+func TestCompressionWeakensETag(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Connection: buf}
+	w.EnableCompression(requestHeaders(t, "Accept-Encoding: gzip\r\n"))
+	w.Header().Set("ETag", `"abc"`)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/html")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte(page))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `W/"abc"`, resp.Header.Get("ETag"))
+}
+
+func TestBytesWritten(t *testing.T) {
+	// Test: The body is counted, not the head
+	buf := &bytes.Buffer{}
+	w := &Writer{Connection: buf}
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(len(page))))
+	head := buf.Len()
+	_, err := w.WriteBody([]byte(page))
+	require.NoError(t, err)
+	assert.Equal(t, StatusOK, w.StatusCode())
+	assert.EqualValues(t, len(page), w.BytesWritten())
+	assert.EqualValues(t, buf.Len()-head, w.BytesWritten())
+
+	// Test: A compressed body is counted compressed, without the chunk framing
+	buf = &bytes.Buffer{}
+	w = &Writer{Connection: buf}
+	w.EnableCompression(requestHeaders(t, "Accept-Encoding: gzip\r\n"))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(len(page))))
+	head = buf.Len()
+	_, err = w.WriteBody([]byte(page))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	compressed, err := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(buf.Bytes()[head:])))
+	require.NoError(t, err)
+	assert.Less(t, w.BytesWritten(), int64(len(page)))
+	assert.EqualValues(t, len(compressed), w.BytesWritten())
+
+	// Test: Only the data of the chunks a handler writes is counted
+	buf = &bytes.Buffer{}
+	w = &Writer{Connection: buf}
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	h.Set("X-Sum", "abc")
+	require.NoError(t, w.WriteTrailers(h))
+	assert.EqualValues(t, 5, w.BytesWritten())
+}
@@ -0,0 +1,114 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// ETagFromContent is a strong validator: the hash of the body.
+func ETagFromContent(body []byte) headers.ETag {
+	sum := sha256.Sum256(body)
+	return headers.ETag{Value: base64.RawURLEncoding.EncodeToString(sum[:16])}
+}
+
+// ETagFromFileInfo is a validator built from the size and the modification
+// time of a file, cheaper than hashing it. The modification time in
+// nanoseconds changes with each write, so it is a strong one, usable by
+// If-Range, like nginx does.
+func ETagFromFileInfo(size int64, modtime time.Time) headers.ETag {
+	return headers.ETag{
+		Value: strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(modtime.UnixNano(), 16),
+	}
+}
+
+// CheckPreconditions adds ETag and Last-Modified to the response and
+// evaluates the conditional fields of the request against them, in the order
+// of RFC 9110 §13.2.2: If-Match, If-Unmodified-Since, If-None-Match then
+// If-Modified-Since. When the request stops there it writes the 304 or 412
+// and returns true. A zero etag or modtime isn't sent nor compared.
+func (w *Writer) CheckPreconditions(req headers.Headers, method string, etag headers.ETag, modtime time.Time) bool {
+	hasETag := etag != (headers.ETag{})
+	if hasETag {
+		w.Header().Replace("ETag", etag.String())
+	}
+	if !modtime.IsZero() {
+		modtime = modtime.UTC().Truncate(time.Second)
+		w.Header().Replace("Last-Modified", modtime.Format(tools.TimeFormat))
+	}
+
+	if _, err := req.Get("if-match"); err == nil {
+		if !matchAny(req.IfMatch(), etag, true) {
+			w.writeEmpty(StatusPreconditionFailed)
+			return true
+		}
+	} else if since, ok := req.IfUnmodifiedSince(); ok && !modtime.IsZero() {
+		if modtime.After(since) {
+			w.writeEmpty(StatusPreconditionFailed)
+			return true
+		}
+	}
+
+	safe := method == "GET" || method == "HEAD"
+	if _, err := req.Get("if-none-match"); err == nil {
+		if matchAny(req.IfNoneMatch(), etag, false) {
+			if safe {
+				w.writeEmpty(StatusNotModified)
+			} else {
+				w.writeEmpty(StatusPreconditionFailed)
+			}
+			return true
+		}
+	} else if since, ok := req.IfModifiedSince(); ok && safe && !modtime.IsZero() {
+		if !modtime.After(since) {
+			w.writeEmpty(StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny compares etag to the tags of a conditional field. The strong
+// comparison of If-Match fails on weak tags, the weak one of If-None-Match
+// only looks at the values. "*" matches the current representation, with or
+// without etag.
+func matchAny(tags []headers.ETag, etag headers.ETag, strong bool) bool {
+	for _, t := range tags {
+		if t.Value == "*" {
+			return true
+		}
+		if etag.Value == "" {
+			continue
+		}
+		if strong && (t.Weak || etag.Weak) {
+			continue
+		}
+		if t.Value == etag.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEmpty writes a response without body, its validators come from
+// Header.
+func (w *Writer) writeEmpty(statusCode tools.StatusCode) {
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+		return
+	}
+	h := headers.NewHeaders()
+	h.Set("Connection", "close")
+	if statusCode != StatusNotModified {
+		h.Set("Content-Length", "0")
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+	}
+}
@@ -0,0 +1,95 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+var lastModified = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// precondition returns the status written by CheckPreconditions, 0 when the
+// request goes on.
+func precondition(t *testing.T, method, lines string, etag headers.ETag) (int, http.Header) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Connection: buf}
+	if !w.CheckPreconditions(requestHeaders(t, lines), method, etag, lastModified) {
+		assert.Equal(t, 0, buf.Len())
+		return 0, nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	return resp.StatusCode, resp.Header
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	strong := ETagFromContent([]byte("hello"))
+	weak := headers.ETag{Value: strong.Value, Weak: true}
+	quoted := strong.String()
+
+	// Test: Validators
+	assert.False(t, strong.Weak)
+	assert.Equal(t, strong, ETagFromContent([]byte("hello")))
+	assert.NotEqual(t, strong, ETagFromContent([]byte("hello!")))
+	assert.False(t, ETagFromFileInfo(5, lastModified).Weak)
+	assert.NotEqual(t, ETagFromFileInfo(5, lastModified), ETagFromFileInfo(5, lastModified.Add(time.Nanosecond)))
+
+	// Test: If-None-Match, weak comparison
+	code, h := precondition(t, "GET", "If-None-Match: \"x\", W/"+quoted+"\r\n", strong)
+	assert.Equal(t, 304, code)
+	assert.Equal(t, quoted, h.Get("ETag"))
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", h.Get("Last-Modified"))
+	assert.Equal(t, "", h.Get("Content-Length"))
+	code, _ = precondition(t, "GET", "If-None-Match: *\r\n", weak)
+	assert.Equal(t, 304, code)
+	code, _ = precondition(t, "POST", "If-None-Match: *\r\n", strong)
+	assert.Equal(t, 412, code)
+	code, _ = precondition(t, "GET", "If-None-Match: \"x\"\r\n", strong)
+	assert.Equal(t, 0, code)
+
+	// Test: If-Match, strong comparison
+	code, _ = precondition(t, "PUT", "If-Match: "+quoted+"\r\n", strong)
+	assert.Equal(t, 0, code)
+	code, _ = precondition(t, "PUT", "If-Match: "+quoted+"\r\n", weak)
+	assert.Equal(t, 412, code)
+	code, _ = precondition(t, "PUT", "If-Match: \"x\"\r\n", strong)
+	assert.Equal(t, 412, code)
+
+	// Test: "*" matches an existing resource without ETag
+	code, _ = precondition(t, "PUT", "If-Match: *\r\n", headers.ETag{})
+	assert.Equal(t, 0, code)
+	code, _ = precondition(t, "PUT", "If-None-Match: *\r\n", headers.ETag{})
+	assert.Equal(t, 412, code)
+	code, _ = precondition(t, "PUT", "If-Match: \"x\"\r\n", headers.ETag{})
+	assert.Equal(t, 412, code)
+
+	// Test: Dates
+	code, _ = precondition(t, "GET", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 304, code)
+	code, _ = precondition(t, "GET", "If-Modified-Since: Thu, 29 Feb 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 0, code)
+	code, _ = precondition(t, "POST", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 0, code)
+	code, _ = precondition(t, "PUT", "If-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 412, code)
+	code, _ = precondition(t, "PUT", "If-Unmodified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 0, code)
+
+	// Test: Precedence, the tags win over the dates
+	code, _ = precondition(t, "GET",
+		"If-None-Match: \"x\"\r\nIf-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 0, code)
+	code, _ = precondition(t, "PUT",
+		"If-Match: "+quoted+"\r\nIf-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT\r\n", strong)
+	assert.Equal(t, 0, code)
+	code, _ = precondition(t, "GET",
+		"If-Match: \"x\"\r\nIf-None-Match: "+quoted+"\r\n", strong)
+	assert.Equal(t, 412, code)
+}
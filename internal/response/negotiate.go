@@ -0,0 +1,200 @@
+package response
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+// Representation is one form of a resource a handler can produce. Empty
+// fields aren't negotiated: ContentType "" accepts any Accept, Encoding ""
+// is the identity coding.
+type Representation struct {
+	ContentType string
+	Language    string
+	Encoding    string
+}
+
+// Negotiate picks among offers, listed by order of preference of the
+// server, the one the client prefers according to the Accept,
+// Accept-Language and Accept-Encoding fields of req (RFC 9110 §12.5). It
+// adds to Vary the fields the choice depends on. When nothing is acceptable
+// it writes a 406 response listing the offers and returns false.
+func (w *Writer) Negotiate(req headers.Headers, offers []Representation) (Representation, bool) {
+	w.addVary(offers)
+
+	accept := req.Accept()
+	languages := req.AcceptLanguage()
+	_, err := req.Get("accept-encoding")
+	hasEncoding := err == nil
+	encodings := req.AcceptEncoding()
+
+	best, bestQ := -1, 0.0
+	for i, offer := range offers {
+		q := 1.0
+		if offer.ContentType != "" && len(accept) > 0 {
+			q *= mediaTypeQ(accept, offer.ContentType)
+		}
+		if offer.Language != "" && len(languages) > 0 {
+			q *= languageQ(languages, offer.Language)
+		}
+		if hasEncoding {
+			q *= encodingQ(encodings, offer.Encoding)
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	if best == -1 {
+		w.writeNotAcceptable(offers)
+		return Representation{}, false
+	}
+	return offers[best], true
+}
+
+// addVary lists the fields for which the offers differ.
+func (w *Writer) addVary(offers []Representation) {
+	vary := []string{}
+	differ := func(field func(Representation) string) bool {
+		for _, o := range offers {
+			if field(o) != field(offers[0]) {
+				return true
+			}
+		}
+		return false
+	}
+	if differ(func(r Representation) string { return r.ContentType }) {
+		vary = append(vary, "Accept")
+	}
+	if differ(func(r Representation) string { return r.Language }) {
+		vary = append(vary, "Accept-Language")
+	}
+	if differ(func(r Representation) string { return r.Encoding }) {
+		vary = append(vary, "Accept-Encoding")
+	}
+	if len(vary) > 0 {
+		w.Header().Set("Vary", strings.Join(vary, ", "))
+	}
+}
+
+// mediaTypeQ is the weight of the most specific range matching offer.
+func mediaTypeQ(accept []headers.MediaRange, offer string) float64 {
+	mediaType, params, err := headers.ParseMediaType(offer)
+	if err != nil {
+		return 0
+	}
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, r := range accept {
+		s := 0
+		switch {
+		case r.Type == "*":
+		case r.Type == typ && r.Subtype == "*":
+			s = 1
+		case r.Type == typ && r.Subtype == sub:
+			s = 2
+		default:
+			continue
+		}
+		if !paramsMatch(r.Params, params) {
+			continue
+		}
+		s += len(r.Params)
+		if s > specificity {
+			q, specificity = r.Q, s
+		}
+	}
+	return q
+}
+
+func paramsMatch(want, have map[string]string) bool {
+	for k, v := range want {
+		if !strings.EqualFold(have[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// languageQ is the weight of the longest range matching offer with the
+// basic filtering of RFC 4647: "en" matches "en-US".
+func languageQ(languages []headers.QualityValue, offer string) float64 {
+	q, longest := 0.0, -1
+	for _, l := range languages {
+		match := l.Value == "*" ||
+			strings.EqualFold(l.Value, offer) ||
+			(len(offer) > len(l.Value) &&
+				strings.EqualFold(offer[:len(l.Value)], l.Value) &&
+				offer[len(l.Value)] == '-')
+		if !match {
+			continue
+		}
+		n := len(l.Value)
+		if l.Value == "*" {
+			n = 0
+		}
+		if n > longest {
+			q, longest = l.Q, n
+		}
+	}
+	return q
+}
+
+// encodingQ is the weight of the coding offer, identity is acceptable
+// unless it is excluded explicitly or through "*;q=0".
+func encodingQ(encodings []headers.QualityValue, offer string) float64 {
+	if offer == "" {
+		offer = "identity"
+	}
+	offer = strings.ToLower(offer)
+	wildcard := -1.0
+	for _, e := range encodings {
+		if e.Value == offer {
+			return e.Q
+		}
+		if e.Value == "*" {
+			wildcard = e.Q
+		}
+	}
+	if wildcard >= 0 {
+		return wildcard
+	}
+	if offer == "identity" {
+		return 1
+	}
+	return 0
+}
+
+func (w *Writer) writeNotAcceptable(offers []Representation) {
+	var b strings.Builder
+	b.WriteString("406 Not Acceptable, available representations:\n")
+	for _, o := range offers {
+		fmt.Fprintf(&b, "- %s", o.ContentType)
+		if o.Language != "" {
+			fmt.Fprintf(&b, " (%s)", o.Language)
+		}
+		if o.Encoding != "" {
+			fmt.Fprintf(&b, " [%s]", o.Encoding)
+		}
+		b.WriteString("\n")
+	}
+	body := b.String()
+
+	err := w.WriteStatusLine(StatusNotAcceptable)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+		return
+	}
+	h := GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", "text/plain")
+	err = w.WriteHeaders(h)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+		return
+	}
+	_, err = w.WriteBody([]byte(body))
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+	}
+}
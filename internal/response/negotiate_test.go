@@ -0,0 +1,83 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+func requestHeaders(t *testing.T, lines string) headers.Headers {
+	h := headers.NewHeaders()
+	data := []byte(lines + "\r\n")
+	for {
+		n, done, err := h.Parse(data)
+		require.NoError(t, err)
+		if done {
+			return h
+		}
+		data = data[n:]
+	}
+}
+
+var apiOffers = []Representation{
+	{ContentType: "application/json"},
+	{ContentType: "text/csv"},
+	{ContentType: "text/html"},
+}
+
+func TestNegotiate(t *testing.T) {
+	// Test: Highest q wins
+	w := &Writer{Connection: &bytes.Buffer{}}
+	req := requestHeaders(t, "Accept: text/html;q=0.9, text/csv\r\n")
+	r, ok := w.Negotiate(req, apiOffers)
+	require.True(t, ok)
+	assert.Equal(t, "text/csv", r.ContentType)
+	assert.Equal(t, "Accept", w.Header()["Vary"])
+
+	// Test: Most specific range gives the q, ties go to the server order
+	w = &Writer{Connection: &bytes.Buffer{}}
+	req = requestHeaders(t, "Accept: text/*, text/csv;q=0.2, */*;q=0.5\r\n")
+	r, ok = w.Negotiate(req, apiOffers)
+	require.True(t, ok)
+	assert.Equal(t, "text/html", r.ContentType)
+
+	// Test: No Accept means anything, first offer
+	w = &Writer{Connection: &bytes.Buffer{}}
+	r, ok = w.Negotiate(headers.NewHeaders(), apiOffers)
+	require.True(t, ok)
+	assert.Equal(t, "application/json", r.ContentType)
+
+	// Test: Language prefix and encoding
+	w = &Writer{Connection: &bytes.Buffer{}}
+	req = requestHeaders(t, "Accept-Language: fr;q=0.8, en\r\n"+
+		"Accept-Encoding: gzip, identity;q=0.5\r\n")
+	r, ok = w.Negotiate(req, []Representation{
+		{ContentType: "text/html", Language: "fr-FR"},
+		{ContentType: "text/html", Language: "en-GB"},
+		{ContentType: "text/html", Language: "en-GB", Encoding: "gzip"},
+	})
+	require.True(t, ok)
+	assert.Equal(t, "en-GB", r.Language)
+	assert.Equal(t, "gzip", r.Encoding)
+	assert.Equal(t, "Accept-Language, Accept-Encoding", w.Header()["Vary"])
+
+	// Test: Nothing acceptable answers 406
+	buf := &bytes.Buffer{}
+	w = &Writer{Connection: buf}
+	req = requestHeaders(t, "Accept: image/png, text/csv;q=0\r\n")
+	_, ok = w.Negotiate(req, apiOffers)
+	require.False(t, ok)
+	assert.Contains(t, buf.String(), "HTTP/1.1 406 Not Acceptable\r\n")
+	assert.Contains(t, buf.String(), "Vary: Accept\r\n")
+	assert.Contains(t, buf.String(), "- text/csv\n")
+
+	// Test: Identity refused through the wildcard
+	w = &Writer{Connection: &bytes.Buffer{}}
+	req = requestHeaders(t, "Accept-Encoding: *;q=0\r\n")
+	_, ok = w.Negotiate(req, apiOffers)
+	require.False(t, ok)
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"strconv"
 	"strings"
 
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/cookie"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
 )
@@ -19,73 +21,163 @@ const (
 	// _
 	// StatusBadRequest
 	// StatusInternalServerError
-	StatusOK                  tools.StatusCode = 200
-	StatusBadRequest          tools.StatusCode = 400
-	StatusInternalServerError tools.StatusCode = 500
+	StatusContinue             tools.StatusCode = 100
+	StatusEarlyHints           tools.StatusCode = 103
+	StatusOK                   tools.StatusCode = 200
+	StatusPartialContent       tools.StatusCode = 206
+	StatusMovedPermanently     tools.StatusCode = 301
+	StatusNotModified          tools.StatusCode = 304
+	StatusBadRequest           tools.StatusCode = 400
+	StatusForbidden            tools.StatusCode = 403
+	StatusNotFound             tools.StatusCode = 404
+	StatusMethodNotAllowed     tools.StatusCode = 405
+	StatusNotAcceptable        tools.StatusCode = 406
+	StatusPreconditionFailed   tools.StatusCode = 412
+	StatusContentTooLarge      tools.StatusCode = 413
+	StatusUnsupportedMediaType tools.StatusCode = 415
+	StatusRangeNotSatisfiable  tools.StatusCode = 416
+	StatusExpectationFailed    tools.StatusCode = 417
+	StatusInternalServerError  tools.StatusCode = 500
+	StatusBadGateway           tools.StatusCode = 502
+	StatusServiceUnavailable   tools.StatusCode = 503
+	StatusGatewayTimeout       tools.StatusCode = 504
 	//
 	WriterStatusLine tools.WriterState = 0
 	WriterHeaders    tools.WriterState = 1
 	WriterBoby       tools.WriterState = 2
 )
 
+var statusText = map[tools.StatusCode]string{
+	StatusContinue:             "Continue",
+	StatusEarlyHints:           "Early Hints",
+	StatusOK:                   "OK",
+	StatusPartialContent:       "Partial Content",
+	StatusMovedPermanently:     "Moved Permanently",
+	StatusNotModified:          "Not Modified",
+	StatusBadRequest:           "Bad Request",
+	StatusForbidden:            "Forbidden",
+	StatusNotFound:             "Not Found",
+	StatusMethodNotAllowed:     "Method Not Allowed",
+	StatusNotAcceptable:        "Not Acceptable",
+	StatusPreconditionFailed:   "Precondition Failed",
+	StatusContentTooLarge:      "Content Too Large",
+	StatusUnsupportedMediaType: "Unsupported Media Type",
+	StatusRangeNotSatisfiable:  "Range Not Satisfiable",
+	StatusExpectationFailed:    "Expectation Failed",
+	StatusInternalServerError:  "Internal Server Error",
+	StatusBadGateway:           "Bad Gateway",
+	StatusServiceUnavailable:   "Service Unavailable",
+	StatusGatewayTimeout:       "Gateway Timeout",
+}
+
 type Writer struct {
 	writerState tools.WriterState
 	Connection  io.Writer
+	// Log receives the errors of the response, nil logs to slog.Default.
+	// The server sets one with the fields of the connection.
+	Log        *slog.Logger
+	cookies    []string
+	header     headers.Headers
+	statusCode tools.StatusCode
+	// written counts the bytes of the body sent to Connection, without the
+	// chunk framing
+	written int64
+
+	compress       bool
+	acceptEncoding []headers.QualityValue
+	compressor     io.WriteCloser
+}
+
+// StatusText returns the reason phrase of statusCode, "" when unknown.
+func StatusText(statusCode tools.StatusCode) string {
+	return statusText[statusCode]
 }
 
 func (w *Writer) Write(b []byte) (int, error) {
-	return w.Connection.Write(b)
+	n, err := w.Connection.Write(b)
+	if w.writerState == WriterBoby {
+		w.written += int64(n)
+	}
+	return n, err
 }
 
 func (w *Writer) WriteStatusLine(statusCode tools.StatusCode) error {
 	if w.writerState != WriterStatusLine {
 		return errors.New("writer not in status line states")
 	}
-	var err error
-	switch statusCode {
-	case 200:
-		// fmt.FprintF remplace w.Write([]byte(fmt.Sprintf(...))
-		_, err = fmt.Fprintf(
-			w, "HTTP/1.1 %d %s%s",
-			statusCode, "OK", tools.CRLF,
-		)
-	case 400:
-		_, err = fmt.Fprintf(
-			w, "HTTP/1.1 %d %s%s",
-			statusCode, "Bad Request", tools.CRLF,
-		)
-	case 500:
-		_, err = fmt.Fprintf(
-			w, "HTTP/1.1 %d %s%s",
-			statusCode, "Internal Server Error", tools.CRLF,
+	if statusCode < 200 {
+		return fmt.Errorf(
+			"%d is an interim status, use WriteInterim", statusCode,
 		)
-	default:
-		_, err = fmt.Fprintf(w, "HTTP/1.1 %d %s", statusCode, tools.CRLF)
 	}
+	err := w.writeStatusLine(statusCode)
 	if err == nil {
 		w.writerState = WriterHeaders
+		w.statusCode = statusCode
 	}
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
-	h := headers.NewHeaders()
-	err := h.Set("Content-Length", strconv.Itoa(contentLen))
-	if err != nil {
-		fmt.Println(err)
-		return nil
+// WriteInterim sends a 1xx response, like 100 Continue or 103 Early Hints,
+// with its headers. The writer stays in the status line state so the final
+// response can follow.
+func (w *Writer) WriteInterim(statusCode tools.StatusCode, h headers.Headers) error {
+	if w.writerState != WriterStatusLine {
+		return errors.New("writer not in status line states")
 	}
-	err = h.Set("Connection", "close")
-	if err != nil {
-		fmt.Println(err)
-		return nil
+	if statusCode < 100 || statusCode > 199 || statusCode == 101 {
+		return fmt.Errorf("%d is not an interim status", statusCode)
 	}
-	err = h.Set("Content-Type", "text/html")
+	err := w.writeStatusLine(statusCode)
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return err
+	}
+	_, err = w.Write(appendHeaders([]byte{}, h))
+	return err
+}
+
+// Logger returns Log, or slog.Default when it is nil.
+func (w *Writer) Logger() *slog.Logger {
+	if w.Log == nil {
+		return slog.Default()
+	}
+	return w.Log
+}
+
+// StatusCode returns the status of the response, 0 before WriteStatusLine.
+func (w *Writer) StatusCode() tools.StatusCode {
+	return w.statusCode
+}
+
+// BytesWritten returns the size of the body sent so far, like %b in the
+// Apache logs: compressed when it is, but without the chunk sizes, the last
+// chunk and the trailers.
+func (w *Writer) BytesWritten() int64 {
+	return w.written
+}
+
+// State returns where the writer is in the response.
+func (w *Writer) State() tools.WriterState {
+	return w.writerState
+}
+
+func (w *Writer) writeStatusLine(statusCode tools.StatusCode) error {
+	// fmt.FprintF remplace w.Write([]byte(fmt.Sprintf(...))
+	_, err := fmt.Fprintf(
+		w, "HTTP/1.1 %d %s%s",
+		statusCode, statusText[statusCode], tools.CRLF,
+	)
+	return err
+}
+
+// GetDefaultHeaders returns the headers of a text/html body of contentLen
+// bytes on a connection closed after the response.
+func GetDefaultHeaders(contentLen int) headers.Headers {
+	return headers.Headers{
+		"Content-Length": strconv.Itoa(contentLen),
+		"Connection":     "close",
+		"Content-Type":   "text/html",
 	}
-	return h
 }
 
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
@@ -93,25 +185,110 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 		return errors.New("writer not in headers states")
 	}
 	b := []byte{}
-	for k, v := range headers {
-		b = fmt.Appendf(b, "%s: %s%s", k, v, tools.CRLF)
+	// un Set-Cookie par ligne, ils ne se combinent pas avec ", "
+	for _, c := range w.cookies {
+		b = fmt.Appendf(b, "Set-Cookie: %s%s", c, tools.CRLF)
 	}
-	b = append(b, tools.CRLF...)
-	_, err := w.Write(b)
+	h := w.setupCompression(w.mergeHeaders(headers))
+	_, err := w.Write(appendHeaders(b, h))
 	if err == nil {
 		w.writerState = WriterBoby
 	}
 	return err
 }
 
+// Header returns the headers added to the ones given to WriteHeaders. Those
+// take precedence, except for Vary whose values are combined.
+func (w *Writer) Header() headers.Headers {
+	if w.header == nil {
+		w.header = headers.NewHeaders()
+	}
+	return w.header
+}
+
+func (w *Writer) mergeHeaders(h headers.Headers) headers.Headers {
+	if len(w.header) == 0 {
+		return h
+	}
+	all := headers.NewHeaders()
+	for k, v := range h {
+		all[k] = v
+	}
+	for k, v := range w.header {
+		existing, err := all.Get(k)
+		if err != nil {
+			all[k] = v
+		} else if strings.EqualFold(k, "vary") {
+			all.Replace(k, existing+", "+v)
+		}
+	}
+	return all
+}
+
+// SetCookie adds a Set-Cookie header line to the response, it must be
+// called before WriteHeaders.
+func (w *Writer) SetCookie(c *cookie.Cookie) error {
+	if w.writerState == WriterBoby {
+		return errors.New("headers already written")
+	}
+	err := c.Valid()
+	if err != nil {
+		return err
+	}
+	w.cookies = append(w.cookies, c.String())
+	return nil
+}
+
+// AddSetCookie adds a Set-Cookie header line as is, for a value that was
+// already formatted, by an upstream server for instance.
+func (w *Writer) AddSetCookie(v string) error {
+	if w.writerState == WriterBoby {
+		return errors.New("headers already written")
+	}
+	if strings.ContainsAny(v, "\r\n") {
+		return errors.New("invalid Set-Cookie value")
+	}
+	w.cookies = append(w.cookies, v)
+	return nil
+}
+
+func appendHeaders(b []byte, h headers.Headers) []byte {
+	for k, v := range h {
+		b = fmt.Appendf(b, "%s: %s%s", k, v, tools.CRLF)
+	}
+	return append(b, tools.CRLF...)
+}
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.writerState != WriterBoby {
 		return 0, errors.New("writer not in body states")
 	}
+	if w.compressor != nil {
+		return w.compressor.Write(p)
+	}
 	return w.Write(p)
 }
 
+// WriteBodyFrom copies r to the body without holding it in memory.
+func (w *Writer) WriteBodyFrom(r io.Reader) (int64, error) {
+	if w.writerState != WriterBoby {
+		return 0, errors.New("writer not in body states")
+	}
+	return io.Copy(bodyWriter{w}, r)
+}
+
+type bodyWriter struct {
+	w *Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.WriteBody(p)
+}
+
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.writerState != WriterBoby {
+		return 0, errors.New("writer not in body states")
+	}
 	var total int
 	var err error
 	chunkSize := tools.ChunkSize
@@ -123,12 +300,7 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	for i := 0; len(p) > i; i = i + chunkSize {
 		var n int
 		idx := min(i+chunkSize, len(p))
-		buf := []byte{}
-		buf = fmt.Appendf(
-			buf, "%X%s%s%s",
-			len(p[i:idx]), tools.CRLF, p[i:idx], tools.CRLF,
-		)
-		n, err = w.WriteBody(buf)
+		n, err = w.writeChunk(p[i:idx])
 		if err != nil {
 			return total, err
 		}
@@ -137,13 +309,32 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	return total, err
 }
 
+// writeChunk sends p as one chunk. Only p counts in BytesWritten, the size
+// line and the CRLF are framing.
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	buf := fmt.Appendf([]byte{}, "%X%s", len(p), tools.CRLF)
+	buf = append(buf, p...)
+	buf = append(buf, tools.CRLF...)
+	n, err := w.Connection.Write(buf)
+	if err == nil {
+		w.written += int64(len(p))
+	}
+	return n, err
+}
+
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	return w.WriteBody(
+	if w.writerState != WriterBoby {
+		return 0, errors.New("writer not in body states")
+	}
+	return w.Connection.Write(
 		fmt.Appendf([]byte{}, "%X%s", 0, tools.CRLF),
 	)
 }
 
 func (w *Writer) WriteTrailers(h headers.Headers) error {
+	if w.writerState != WriterBoby {
+		return errors.New("writer not in body states")
+	}
 	trailers, ok := h["Trailer"]
 	if !ok {
 		return fmt.Errorf("key %s not found in headers", "Trailers")
@@ -151,22 +342,18 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 	for trailer := range strings.SplitSeq(trailers, ", ") {
 		v, ok := h[trailer]
 		if !ok {
-			fmt.Printf("value of trailer '%s' not found", trailer)
+			w.Logger().Warn("trailer value not found", "trailer", trailer)
 			continue
 		}
 
-		fmt.Printf("%s: %s%s", trailer, v, tools.CRLF)
-		_, err := w.WriteBody(
+		_, err := w.Connection.Write(
 			fmt.Appendf([]byte{}, "%s: %s%s", trailer, v, tools.CRLF),
 		)
 		if err != nil {
-			fmt.Printf(
-				"trailer '%s' - couldn't write the value: %v",
-				trailer, v,
-			)
+			w.Logger().Error("writing trailer failed", "trailer", trailer, "err", err)
 			continue
 		}
 	}
-	w.WriteBody([]byte(tools.CRLF))
+	w.Connection.Write([]byte(tools.CRLF))
 	return nil
 }
@@ -0,0 +1,67 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/cookie"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/headers"
+)
+
+func TestWriteInterim(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Connection: buf}
+
+	// Test: 101 and final statuses are refused, nothing is written
+	assert.Error(t, w.WriteInterim(101, nil))
+	assert.Error(t, w.WriteInterim(StatusOK, nil))
+	assert.Error(t, w.WriteInterim(StatusBadRequest, nil))
+	assert.Zero(t, buf.Len())
+
+	// Test: 100 then 103 with its headers, the writer stays on the status line
+	require.NoError(t, w.WriteInterim(StatusContinue, nil))
+	h := headers.NewHeaders()
+	h["Link"] = "</style.css>; rel=preload"
+	require.NoError(t, w.WriteInterim(StatusEarlyHints, h))
+	assert.Equal(t, WriterStatusLine, w.State())
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n", buf.String())
+
+	// Test: The final response follows, no interim after it
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.Error(t, w.WriteInterim(StatusContinue, nil))
+
+	// Test: WriteStatusLine refuses 1xx
+	w = &Writer{Connection: &bytes.Buffer{}}
+	assert.Error(t, w.WriteStatusLine(StatusContinue))
+	assert.Equal(t, WriterStatusLine, w.State())
+}
+
+func TestSetCookie(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Connection: buf}
+
+	// Test: CR and LF can't smuggle a header
+	assert.Error(t, w.AddSetCookie("a=b\r\nX-Injected: 1"))
+	assert.Error(t, w.AddSetCookie("a=b\nX-Injected: 1"))
+	assert.Error(t, w.SetCookie(&cookie.Cookie{Name: "bad name", Value: "x"}))
+
+	// Test: One Set-Cookie line per cookie, never joined with ", "
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "session", Value: "abc", HttpOnly: true}))
+	require.NoError(t, w.AddSetCookie("theme=dark; Path=/"))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Contains(t, buf.String(), "\r\nSet-Cookie: session=abc; HttpOnly\r\n")
+	assert.Contains(t, buf.String(), "\r\nSet-Cookie: theme=dark; Path=/\r\n")
+	assert.Equal(t, 2, strings.Count(buf.String(), "Set-Cookie:"))
+	assert.NotContains(t, buf.String(), "HttpOnly, theme")
+
+	// Test: Too late once the headers are written
+	assert.Error(t, w.SetCookie(&cookie.Cookie{Name: "late", Value: "1"}))
+	assert.Error(t, w.AddSetCookie("late=1"))
+	assert.Equal(t, 2, strings.Count(buf.String(), "Set-Cookie:"))
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+// LogFormat is the format of the lines written by AccessLog.
+type LogFormat int
+
+const (
+	// CommonLog is the Common Log Format of Apache:
+	//   host - - [time] "request line" status bytes
+	CommonLog LogFormat = iota
+	// CombinedLog adds the referer and the user agent, as Apache does, so
+	// that the usual tools can read it.
+	CombinedLog
+	// JSONLog writes the same fields and the latency as a JSON object per
+	// line.
+	JSONLog
+)
+
+// clfTime is the layout of the timestamps of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// ParseLogFormat reads "common", "combined" or "json".
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch s {
+	case "combined", "":
+		return CombinedLog, nil
+	case "common":
+		return CommonLog, nil
+	case "json":
+		return JSONLog, nil
+	}
+	return 0, fmt.Errorf("unknown access log format: %s", s)
+}
+
+// accessEntry is what AccessLog records of a request.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Referer   string    `json:"referer"`
+	UserAgent string    `json:"user_agent"`
+	LatencyMs float64   `json:"latency_ms"`
+}
+
+// AccessLog writes a line to out in format for each request handled by h,
+// once the response is sent. out is a RotatingFile or os.Stdout for
+// instance, it gets one Write per line. The requests the server answers
+// itself, like a 417 to an unknown Expect, don't reach h and aren't logged.
+func AccessLog(h Handler, out io.Writer, format LogFormat) Handler {
+	var mu sync.Mutex
+	return func(w *response.Writer, req *request.Request) {
+		start := req.ReceivedAt
+		if start.IsZero() {
+			start = time.Now()
+		}
+		h(w, req)
+		// le compresseur garde des octets jusqu'à Close, ils comptent dans la taille
+		err := w.Close()
+		if err != nil {
+			w.Logger().Error("closing response failed", "err", err)
+		}
+
+		e := accessEntry{
+			Time:      start,
+			Remote:    req.RemoteAddr,
+			Method:    req.RequestLine.Method,
+			Path:      req.RequestLine.RequestTarget,
+			Proto:     "HTTP/" + req.RequestLine.HttpVersion,
+			Status:    int(w.StatusCode()),
+			Bytes:     w.BytesWritten(),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if host, _, err := net.SplitHostPort(e.Remote); err == nil {
+			e.Remote = host
+		}
+		e.Referer, _ = req.Headers.Get("referer")
+		e.UserAgent, _ = req.Headers.Get("user-agent")
+
+		line := e.append([]byte{}, format)
+		mu.Lock()
+		_, err = out.Write(line)
+		mu.Unlock()
+		if err != nil {
+			w.Logger().Error("writing access log failed", "err", err)
+		}
+	}
+}
+
+func (e *accessEntry) append(b []byte, format LogFormat) []byte {
+	if format == JSONLog {
+		j, _ := json.Marshal(e)
+		return append(j, '\n')
+	}
+	b = append(b, orDash(e.Remote)...)
+	b = append(b, " - - ["...)
+	b = e.Time.AppendFormat(b, clfTime)
+	b = append(b, "] "...)
+	b = appendQuoted(b, e.Method+" "+e.Path+" "+e.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	if e.Bytes == 0 {
+		b = append(b, '-')
+	} else {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	}
+	if format == CombinedLog {
+		b = append(b, ' ')
+		b = appendQuoted(b, orDash(e.Referer))
+		b = append(b, ' ')
+		b = appendQuoted(b, orDash(e.UserAgent))
+	}
+	return append(b, '\n')
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// appendQuoted quotes s the way Apache does: the quotes, the backslashes and
+// the control characters are escaped so that a line can't be forged.
+func appendQuoted(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			b = fmt.Appendf(b, "\\x%02x", c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '"')
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+// serveLogged serves echoTarget with an access log in format, and returns
+// the address and the log buffer.
+func serveLogged(t *testing.T, format LogFormat, opts ...Option) (string, *logBuffer) {
+	out := &logBuffer{}
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListeners(AccessLog(echoTarget, out, format), []net.Listener{l}, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().String(), out
+}
+
+// sendRaw sends head as is and reads the whole response.
+func sendRaw(t *testing.T, addr, head string) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, head)
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+}
+
+// lastLine waits for the nth line of the access log and returns it.
+func lastLine(t *testing.T, out *logBuffer, n int) string {
+	var line string
+	require.Eventually(t, func() bool {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		lines := strings.Split(strings.TrimSuffix(out.buf.String(), "\n"), "\n")
+		if len(lines) < n || lines[0] == "" {
+			return false
+		}
+		line = lines[n-1]
+		return true
+	}, time.Second, 10*time.Millisecond)
+	return line
+}
+
+func TestAccessLog(t *testing.T) {
+	// Test: Common Log Format
+	addr, out := serveLogged(t, CommonLog)
+	before := time.Now()
+	getOver(t, "tcp", addr, "/common")
+	line := lastLine(t, out, 1)
+	clf := regexp.MustCompile(`^127\.0\.0\.1 - - \[([^\]]+)\] "GET /common HTTP/1\.1" 200 7$`)
+	m := clf.FindStringSubmatch(line)
+	require.NotNil(t, m, line)
+	at, err := time.Parse(clfTime, m[1])
+	require.NoError(t, err)
+	assert.WithinRange(t, at, before.Truncate(time.Second), time.Now())
+
+	// Test: Combined adds referer and user agent, escaped, nothing more
+	addr, out = serveLogged(t, CombinedLog)
+	sendRaw(t, addr, "GET /combined HTTP/1.1\r\nHost: localhost\r\n"+
+		"Referer: http://example.com/\r\nUser-Agent: test \"agent\"\x01\r\n\r\n")
+	line = lastLine(t, out, 1)
+	assert.Regexp(t, `^127\.0\.0\.1 - - \[[^\]]+\] "GET /combined HTTP/1\.1" 200 9 `+
+		`"http://example\.com/" "test \\"agent\\"\\x01"$`, line)
+	getOver(t, "tcp", addr, "/")
+	assert.Regexp(t, `" 200 1 "-" "-"$`, lastLine(t, out, 2))
+
+	// Test: JSON lines with the same fields
+	addr, out = serveLogged(t, JSONLog)
+	sendRaw(t, addr, "GET /json HTTP/1.1\r\nHost: localhost\r\nUser-Agent: curl/8\r\n\r\n")
+	var e map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lastLine(t, out, 1)), &e))
+	assert.Equal(t, "127.0.0.1", e["remote"])
+	assert.Equal(t, "GET", e["method"])
+	assert.Equal(t, "/json", e["path"])
+	assert.Equal(t, "HTTP/1.1", e["proto"])
+	assert.EqualValues(t, 200, e["status"])
+	assert.EqualValues(t, 5, e["bytes"])
+	assert.Equal(t, "", e["referer"])
+	assert.Equal(t, "curl/8", e["user_agent"])
+	assert.Contains(t, e, "latency_ms")
+	assert.Contains(t, e, "time")
+}
+
+func TestAccessLogCompressed(t *testing.T) {
+	page := strings.Repeat("compressible ", 200)
+	out := &logBuffer{}
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListeners(AccessLog(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(page)))
+		w.WriteBody([]byte(page))
+	}, out, JSONLog), []net.Listener{l}, WithCompression())
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: The compressed size is logged, without the chunk framing
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\n\r\n")
+	raw, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	_, chunked, ok := strings.Cut(string(raw), "\r\n\r\n")
+	require.True(t, ok)
+	body, err := io.ReadAll(httputil.NewChunkedReader(strings.NewReader(chunked)))
+	require.NoError(t, err)
+	var e map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lastLine(t, out, 1)), &e))
+	assert.EqualValues(t, len(body), e["bytes"])
+	assert.Less(t, len(body), len(page))
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+	f, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer f.Close()
+	read := func(p string) string {
+		b, _ := os.ReadFile(p)
+		return string(b)
+	}
+
+	// Test: Appends to the existing file while it fits
+	_, err = f.Write([]byte("one\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "old\none\n", read(path))
+
+	// Test: A write that doesn't fit goes to a new file, whole
+	_, err = f.Write([]byte("two two\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "two two\n", read(path))
+	assert.Equal(t, "old\none\n", read(path+".1"))
+
+	// Test: Only MaxBackups files are kept
+	for _, s := range []string{"three\n", "four\n", "five\n"} {
+		_, err = f.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "four\nfive\n", read(path))
+	assert.Equal(t, "three\n", read(path+".1"))
+	assert.Equal(t, "two two\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+
+	// Test: Rotate on demand, and nothing after Close
+	require.NoError(t, f.Rotate())
+	assert.Equal(t, "", read(path))
+	assert.Equal(t, "four\nfive\n", read(path+".1"))
+	require.NoError(t, f.Close())
+	_, err = f.Write([]byte("six\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestRotatingFileFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, 10, 1)
+	require.NoError(t, err)
+	defer f.Close()
+	read := func(p string) string {
+		b, _ := os.ReadFile(p)
+		return string(b)
+	}
+	// un dossier non vide à la place de la sauvegarde bloque la rotation
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755))
+
+	// Test: The rotation fails, the line still goes to the current file
+	_, err = f.Write([]byte("one one\n"))
+	require.NoError(t, err)
+	_, err = f.Write([]byte("two two\n"))
+	assert.Error(t, err)
+	assert.Equal(t, "one one\ntwo two\n", read(path))
+
+	// Test: Logging goes on, the next rotation succeeds once unblocked
+	require.NoError(t, os.RemoveAll(path+".1"))
+	_, err = f.Write([]byte("three\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "three\n", read(path))
+	assert.Equal(t, "one one\ntwo two\n", read(path+".1"))
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFdsStart is the first fd passed by systemd, after stdin, stdout and
+// stderr.
+const listenFdsStart = 3
+
+const (
+	// upgradeEnv holds the pid of the process that started us with
+	// Upgrade, it stands for LISTEN_PID which it can't know before the
+	// fork.
+	upgradeEnv = "UPGRADE_PARENT_PID"
+	// readyEnv is the fd SignalReady closes once we serve.
+	readyEnv = "UPGRADE_READY_FD"
+)
+
+// InheritedListeners returns the listeners passed by systemd socket
+// activation (LISTEN_FDS and LISTEN_PID) or by the Upgrade of the previous
+// process, in order. It returns nil when there are none, the variables are
+// then for another process and left alone.
+func InheritedListeners() ([]net.Listener, error) {
+	fds := os.Getenv("LISTEN_FDS")
+	if fds == "" {
+		return nil, nil
+	}
+	switch {
+	case os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()):
+	case os.Getenv("LISTEN_PID") == "" && os.Getenv(upgradeEnv) == strconv.Itoa(os.Getppid()):
+	default:
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %s", fds)
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// comme sd_listen_fds, pour ne pas les passer à nos propres enfants
+	for _, k := range []string{"LISTEN_FDS", "LISTEN_PID", "LISTEN_FDNAMES", upgradeEnv} {
+		os.Unsetenv(k)
+	}
+
+	listeners := []net.Listener{}
+	for i := range n {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// SignalReady tells the process that started us with Upgrade that we serve
+// the listeners, it can stop accepting and drain. It does nothing when we
+// weren't started by Upgrade.
+func SignalReady() error {
+	v := os.Getenv(readyEnv)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(readyEnv)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", readyEnv, v)
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+var errNotReady = errors.New("new process exited before being ready")
+
+// Upgrade starts the executable again with the same arguments and hands it
+// the listeners, then waits until it calls SignalReady. The connections keep
+// being accepted by one process or the other: call Shutdown afterwards to
+// drain this one. On error, the new process is killed and this one goes on
+// serving.
+func (s *Server) Upgrade(ctx context.Context) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	fds := []uintptr{}
+	defer func() {
+		for _, fd := range fds {
+			syscall.Close(int(fd))
+		}
+	}()
+	names := []string{}
+	for _, l := range s.raw {
+		fd, err := dupListener(l)
+		if err != nil {
+			return err
+		}
+		fds = append(fds, fd)
+		names = append(names, l.Addr().Network())
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	env := []string{}
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		switch k {
+		case "LISTEN_FDS", "LISTEN_PID", "LISTEN_FDNAMES", upgradeEnv, readyEnv:
+			continue
+		}
+		env = append(env, kv)
+	}
+	env = append(env,
+		"LISTEN_FDS="+strconv.Itoa(len(fds)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		upgradeEnv+"="+strconv.Itoa(os.Getpid()),
+		readyEnv+"="+strconv.Itoa(listenFdsStart+len(fds)),
+	)
+	// syscall plutôt que os/exec : File.Fd repasserait les sockets, partagés
+	// avec nos listeners, en mode bloquant
+	files := append([]uintptr{0, 1, 2}, fds...)
+	pid, err := syscall.ForkExec(exe, os.Args, &syscall.ProcAttr{
+		Env:   env,
+		Files: append(files, w.Fd()),
+	})
+	w.Close()
+	if err != nil {
+		return err
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	// un octet si l'enfant est prêt, EOF s'il meurt avant
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := io.ReadFull(r, b)
+		if err != nil {
+			err = errNotReady
+		}
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		proc.Kill()
+		proc.Wait()
+		return err
+	}
+
+	// le socket Unix appartient désormais au nouveau processus
+	for _, l := range s.raw {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return proc.Release()
+}
+
+// dupListener returns a copy of the fd of l, closed on exec like the others
+// until ForkExec places it.
+func dupListener(l net.Listener) (uintptr, error) {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("listener %s can't be handed over", l.Addr())
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var dup int
+	var dupErr error
+	err = rc.Control(func(fd uintptr) {
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		dup, dupErr = syscall.Dup(int(fd))
+		if dupErr == nil {
+			syscall.CloseOnExec(dup)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if dupErr != nil {
+		return 0, dupErr
+	}
+	return uintptr(dup), nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+const helperEnv = "SERVER_TEST_HELPER"
+
+// TestHelperProcess is the server the tests below run as a child process:
+// it serves its pid on the inherited listeners, upgrades itself on SIGUSR2
+// and drains on SIGTERM.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperEnv) == "" {
+		t.Skip("run as a child process")
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2, syscall.SIGTERM)
+	listeners, err := InheritedListeners()
+	if err != nil || len(listeners) == 0 {
+		os.Exit(2)
+	}
+	srv, err := ServeListeners(func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		body := []byte(strconv.Itoa(os.Getpid()))
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, listeners)
+	if err != nil {
+		os.Exit(2)
+	}
+	if SignalReady() != nil {
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for sig := range signals {
+		if sig == syscall.SIGUSR2 && srv.Upgrade(ctx) != nil {
+			continue
+		}
+		break
+	}
+	if srv.Shutdown(ctx) != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// startHelper runs TestHelperProcess on l the way systemd does: LISTEN_PID
+// is the pid of the exec'd process.
+func startHelper(t *testing.T, l net.Listener) *exec.Cmd {
+	f, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+	cmd := exec.Command("/bin/sh", "-c", `LISTEN_PID=$$ exec "$0" "$@"`,
+		os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), helperEnv+"=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=http")
+	cmd.ExtraFiles = []*os.File{f}
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+func helperPid(t *testing.T, addr, path string) int {
+	pid, err := strconv.Atoi(getOver(t, "tcp", addr, path))
+	require.NoError(t, err)
+	return pid
+}
+
+func TestSocketActivation(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	cmd := startHelper(t, l)
+	l.Close()
+
+	// Test: The child serves the socket it inherited
+	assert.Equal(t, cmd.Process.Pid, helperPid(t, addr, "/"))
+
+	// Test: SIGTERM drains and exits
+	require.NoError(t, cmd.Process.Signal(syscall.SIGTERM))
+	assert.NoError(t, cmd.Wait())
+
+	// Test: Variables for another process are ignored
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", "1")
+	listeners, err := InheritedListeners()
+	assert.NoError(t, err)
+	assert.Nil(t, listeners)
+	assert.Equal(t, "1", os.Getenv("LISTEN_FDS"))
+}
+
+func TestUpgrade(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	cmd := startHelper(t, l)
+	l.Close()
+	oldPid := helperPid(t, addr, "/")
+
+	// Test: A request in progress is answered by the old process
+	slow := make(chan int, 1)
+	go func() {
+		slow <- helperPid(t, addr, "/slow")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, cmd.Process.Signal(syscall.SIGUSR2))
+
+	// Test: No connection is refused while the new process takes over
+	newPid := oldPid
+	deadline := time.Now().Add(5 * time.Second)
+	for newPid == oldPid && time.Now().Before(deadline) {
+		newPid = helperPid(t, addr, "/")
+	}
+	assert.NotEqual(t, oldPid, newPid)
+	defer syscall.Kill(newPid, syscall.SIGKILL)
+	assert.Equal(t, oldPid, <-slow)
+
+	// Test: The old process exits once drained, the new one goes on
+	assert.NoError(t, cmd.Wait())
+	for range 5 {
+		assert.Equal(t, newPid, helperPid(t, addr, "/"))
+	}
+	require.NoError(t, syscall.Kill(newPid, syscall.SIGTERM))
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Listen opens a listener for addr: "unix:/path/to/socket" for a Unix
+// socket, with ListenUnix and the default mode, or a TCP address such as
+// ":8080", "127.0.0.1:8080" or "[::1]:8080".
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return ListenUnix(path, 0, -1, -1)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenUnix listens on a Unix socket at path. A socket left there by a
+// process that is gone is removed first, one still answering is an error.
+// The socket file gets mode unless it is 0, and the uid and gid owner
+// unless they are -1. It is removed when the listener is closed.
+func ListenUnix(path string, mode os.FileMode, uid, gid int) (net.Listener, error) {
+	err := removeStaleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+	}
+	if err == nil && (uid != -1 || gid != -1) {
+		err = os.Lchown(path, uid, gid)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes the socket at path when nobody listens on it
+// anymore.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	// plus personne derrière, le fichier est resté après un arrêt brutal
+	return os.Remove(path)
+}
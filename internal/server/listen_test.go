@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// getOver sends GET path over network and addr.
+func getOver(t *testing.T, network, addr, path string) string {
+	conn, err := net.Dial(network, addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestServeListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "http.sock")
+	unix, err := Listen("unix:" + sock)
+	require.NoError(t, err)
+	tcp, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	listeners := []net.Listener{unix, tcp}
+	if tcp6, err := Listen("[::1]:0"); err == nil {
+		listeners = append(listeners, tcp6)
+	}
+
+	s, err := ServeListeners(echoTarget, listeners)
+	require.NoError(t, err)
+
+	// Test: Every listener serves the same handler
+	assert.Equal(t, "/unix", getOver(t, "unix", sock, "/unix"))
+	for _, l := range listeners[1:] {
+		assert.Equal(t, "/tcp", getOver(t, "tcp", l.Addr().String(), "/tcp"))
+	}
+
+	// Test: Close closes them all and removes the socket
+	require.NoError(t, s.Close())
+	for _, l := range listeners {
+		_, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		assert.Error(t, err)
+	}
+	_, err = os.Stat(sock)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Test: No listener
+	_, err = ServeListeners(echoTarget, nil)
+	assert.Error(t, err)
+}
+
+// flakyListener fails its first Accepts like a listener out of fds.
+type flakyListener struct {
+	net.Listener
+	fails atomic.Int32
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.fails.Add(-1) >= 0 {
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+func TestAcceptRetry(t *testing.T) {
+	tcp, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	l := &flakyListener{Listener: tcp}
+	l.fails.Store(3)
+	s, err := ServeListeners(echoTarget, []net.Listener{l}, WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+
+	// Test: Failed accepts are retried, the listener still serves
+	assert.Equal(t, "/retry", getOver(t, "tcp", tcp.Addr().String(), "/retry"))
+	assert.Less(t, l.fails.Load(), int32(0))
+
+	// Test: Close ends the loop
+	require.NoError(t, s.Close())
+	done := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("accept loop still running")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "http.sock")
+
+	// Test: Mode and owner of the socket file
+	l, err := ListenUnix(sock, 0o660, os.Getuid(), os.Getgid())
+	require.NoError(t, err)
+	info, err := os.Stat(sock)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+	// Test: A socket in use is not taken over
+	_, err = ListenUnix(sock, 0, -1, -1)
+	assert.Error(t, err)
+
+	// Test: A stale socket is replaced
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	_, err = os.Stat(sock)
+	require.NoError(t, err)
+	l, err = ListenUnix(sock, 0, -1, -1)
+	require.NoError(t, err)
+	defer l.Close()
+	s, err := ServeListeners(echoTarget, []net.Listener{l})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, "/again", getOver(t, "unix", sock, "/again"))
+
+	// Test: Other files are left alone
+	other := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(other, nil, 0o600))
+	_, err = ListenUnix(other, 0, -1, -1)
+	assert.Error(t, err)
+}
+
+func TestServeProxyProtocol(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListeners(func(w *response.Writer, req *request.Request) {
+		body := []byte(req.RemoteAddr)
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, []net.Listener{l}, WithProxyProtocol(true, netip.MustParsePrefix("127.0.0.1/32")))
+	require.NoError(t, err)
+	defer s.Close()
+
+	send := func(raw string) (string, error) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		io.WriteString(conn, raw+"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// Test: The request comes from the client named by the header
+	addr, err := send("PROXY TCP4 203.0.113.7 192.0.2.1 51000 80\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7:51000", addr)
+
+	// Test: Connections without header are closed
+	_, err = send("")
+	assert.Error(t, err)
+}
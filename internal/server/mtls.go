@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+// LoadCAs reads the PEM certificates of files into a pool, for
+// WithClientAuth.
+func LoadCAs(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: no certificate found", f)
+		}
+	}
+	return pool, nil
+}
+
+// WithClientAuth verifies the client certificates against cas. When
+// required, the handshake fails without one; otherwise a client may come
+// without certificate and RequireClientCert protects the routes that need
+// one. It only applies with WithTLS.
+func WithClientAuth(cas *x509.CertPool, required bool) Option {
+	return func(s *Server) {
+		s.clientCAs = cas
+		s.clientAuth = tls.VerifyClientCertIfGiven
+		if required {
+			s.clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+}
+
+// RequireClientCert answers 403 to the requests that came without a verified
+// client certificate, and calls h for the others. With names, the subject
+// common name or one of the DNS names of the certificate must be among them.
+func RequireClientCert(h Handler, names ...string) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		cert := req.ClientCertificate()
+		if cert == nil || (len(names) > 0 && !certMatches(cert, names)) {
+			reject(w, response.StatusForbidden)
+			return
+		}
+		h(w, req)
+	}
+}
+
+func certMatches(cert *x509.Certificate, names []string) bool {
+	for _, n := range names {
+		if n == cert.Subject.CommonName ||
+			slices.ContainsFunc(cert.DNSNames, func(dns string) bool {
+				return strings.EqualFold(dns, n)
+			}) {
+			return true
+		}
+	}
+	return false
+}
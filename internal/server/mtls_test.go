@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+// issue signs a certificate named cn with parent, self-signed when parent is
+// the zero value.
+func issue(t *testing.T, cn string, isCA bool, parent tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent.Leaf != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func serveMTLS(t *testing.T, caFile string, required bool) string {
+	pair := writeCert(t, t.TempDir(), "server", "example.com")
+	store, err := NewCertStore(pair)
+	require.NoError(t, err)
+	cas, err := LoadCAs(caFile)
+	require.NoError(t, err)
+
+	whoami := func(w *response.Writer, req *request.Request) {
+		body := []byte(req.ClientSubject())
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+	private := RequireClientCert(whoami)
+	admin := RequireClientCert(whoami, "admin")
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/private":
+			private(w, req)
+		case "/admin":
+			admin(w, req)
+		default:
+			whoami(w, req)
+		}
+	}, WithTLS(store.TLSConfig()), WithClientAuth(cas, required))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s.Listener.Addr().String()
+}
+
+// fetch sends GET path with the client certificate, even when the server
+// doesn't list its CA, and returns the handshake error when it fails.
+func fetch(addr, path string, certs ...tls.Certificate) (int, string, error) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if len(certs) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &certs[0], nil
+		},
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	defer conn.Close()
+	return exchangePath(conn, path)
+}
+
+func writeCA(t *testing.T, ca tls.Certificate) string {
+	f := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]})
+	require.NoError(t, os.WriteFile(f, data, 0o600))
+	return f
+}
+
+func TestClientAuth(t *testing.T) {
+	ca := issue(t, "Test CA", true, tls.Certificate{})
+	alice := issue(t, "alice", false, ca)
+	admin := issue(t, "admin", false, ca)
+	stranger := issue(t, "stranger", false, issue(t, "Other CA", true, tls.Certificate{}))
+	addr := serveMTLS(t, writeCA(t, ca), false)
+
+	// Test: Without certificate, only the public routes answer
+	code, body, err := fetch(addr, "/")
+	require.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "", body)
+	code, _, err = fetch(addr, "/private")
+	require.NoError(t, err)
+	assert.Equal(t, 403, code)
+
+	// Test: A verified certificate reaches the handler with its subject
+	code, body, err = fetch(addr, "/private", alice)
+	require.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "CN=alice,O=Test", body)
+
+	// Test: Routes restricted to some names
+	code, _, err = fetch(addr, "/admin", alice)
+	require.NoError(t, err)
+	assert.Equal(t, 403, code)
+	code, body, err = fetch(addr, "/admin", admin)
+	require.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "CN=admin,O=Test", body)
+
+	// Test: A certificate from another CA is refused at the handshake
+	_, _, err = fetch(addr, "/", stranger)
+	assert.Error(t, err)
+
+	// Test: Required mode refuses the clients without certificate
+	addr = serveMTLS(t, writeCA(t, ca), true)
+	_, _, err = fetch(addr, "/")
+	assert.Error(t, err)
+	code, _, err = fetch(addr, "/private", alice)
+	require.NoError(t, err)
+	assert.Equal(t, 200, code)
+
+	// Test: Invalid CA bundle
+	_, err = LoadCAs(filepath.Join(t.TempDir(), "none.pem"))
+	assert.Error(t, err)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("nothing"), 0o600))
+	_, err = LoadCAs(empty)
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile appends to the file at Path and rotates it once it would grow
+// past MaxSize bytes: Path becomes Path.1, Path.1 becomes Path.2 and so on,
+// up to MaxBackups files. It's safe for concurrent use.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// closed is set by Close, f is also nil when a rotation could not
+	// reopen Path, the next Write tries again then
+	closed bool
+}
+
+// OpenRotatingFile opens path for appending, it is created when missing.
+// A maxSize of 0 never rotates it.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write writes p whole to the current file, rotating it first when p would
+// not fit. A line is never split between two files. When the rotation
+// fails, p still goes to the file at Path and the error is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.f == nil {
+		err := r.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	var rotateErr error
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		rotateErr = r.rotate()
+		if r.f == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, errors.Join(rotateErr, err)
+}
+
+// Rotate starts a new file now, after a SIGHUP for instance.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.f == nil {
+		return r.open()
+	}
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	err = errors.Join(err, r.shift())
+	// même si le décalage a échoué, on continue d'écrire dans Path
+	return errors.Join(err, r.open())
+}
+
+// shift renames Path and its backups one rank up, dropping the last one.
+func (r *RotatingFile) shift() error {
+	if r.MaxBackups == 0 {
+		err := os.Remove(r.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	// la plus ancienne disparaît, les autres prennent un rang de plus
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", r.Path, i) }
+	err := os.Remove(backup(r.MaxBackups))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := r.MaxBackups - 1; i > 0; i-- {
+		err = os.Rename(backup(i), backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = os.Rename(r.Path, backup(1))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	r.closed = true
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
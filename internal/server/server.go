@@ -1,84 +1,406 @@
 package server
 
 import (
-	"fmt"
-	"log"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
 	"net"
+	"net/netip"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/proxyproto"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
 	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/tools"
+)
+
+// readBufferSize bounds the size of a request head.
+const readBufferSize = 64 * 1024
+
+// acceptMinDelay and acceptMaxDelay bound the wait before accepting again
+// after a failed Accept, it doubles at each failure in a row.
+const (
+	acceptMinDelay = 5 * time.Millisecond
+	acceptMaxDelay = time.Second
 )
 
 type Server struct {
-	Port        int
+	Port int
+	// Listener is the first of Listeners.
 	Listener    net.Listener
+	Listeners   []net.Listener
 	IsClosed    atomic.Bool
 	HandlerFunc Handler
+
+	// raw are the listeners before TLS, the ones whose fds are handed over
+	// by Upgrade
+	raw   []net.Listener
+	loops sync.WaitGroup
+	conns sync.WaitGroup
+	// lastConnID numbers the accepted connections
+	lastConnID atomic.Uint64
+	// baseCtx is the parent of the request contexts, cancelled when the
+	// server stops
+	baseCtx        context.Context
+	cancelBase     context.CancelCauseFunc
+	requestTimeout time.Duration
+
+	compress      bool
+	maxDecodedLen int64
+	tlsConfig     *tls.Config
+	clientCAs     *x509.CertPool
+	clientAuth    tls.ClientAuthType
+	proxyProto    *proxyproto.Listener
+	logger        *slog.Logger
+}
+
+// Option configures a Server in Serve.
+type Option func(*Server)
+
+// WithCompression compresses the responses with gzip or deflate when the
+// client accepts it and the content type is worth it.
+func WithCompression() Option {
+	return func(s *Server) {
+		s.compress = true
+	}
+}
+
+// WithRequestDecompression decodes the gzip and deflate request bodies
+// before the handler reads them, up to maxSize decoded bytes. Other codings
+// are refused with a 415.
+func WithRequestDecompression(maxSize int64) Option {
+	return func(s *Server) {
+		s.maxDecodedLen = maxSize
+	}
+}
+
+// WithTLS serves HTTPS with cfg, a CertStore.TLSConfig for instance.
+func WithTLS(cfg *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+	}
+}
+
+// WithProxyProtocol reads the PROXY protocol header sent by the load
+// balancers in trusted (any source when empty) before the request, or the
+// TLS handshake, and serves the client it names. When required, the
+// connections without header are closed.
+func WithProxyProtocol(required bool, trusted ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.proxyProto = &proxyproto.Listener{Required: required, Trusted: trusted}
+	}
+}
+
+// WithRequestTimeout cancels the context of a request d after its headers
+// were received, with ErrRequestTimeout as cause. It's up to the handler to
+// give up then.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.requestTimeout = d
+	}
 }
 
-type Handler func(w response.Writer, req *request.Request)
+// WithLogger sends the logs of the server to logger instead of
+// slog.Default: one line per request at the Info level, the connections at
+// the Debug one. slog.New(slog.DiscardHandler) silences them.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// Handler answers a request. Its body is read into req.Body before the
+// handler runs, except when the client sent Expect: 100-continue: the body
+// is then still on the wire and must be read through req.BodyReader or
+// req.ReadBody, which send the 100 Continue first.
+type Handler func(w *response.Writer, req *request.Request)
 
 // type HandlerError struct {
 // 	StatusCode tools.StatusCode
 // 	Message    string
 // }
 
-func Serve(port int, h Handler) (*Server, error) {
+// Serve listens on port on every interface.
+func Serve(port int, h Handler, opts ...Option) (*Server, error) {
 	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if err != nil {
 		return nil, err
 	}
+	server, err := ServeListeners(h, []net.Listener{l}, opts...)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	server.Port = port
+	return server, nil
+}
+
+// ServeListeners accepts the connections of every listener, TCP or Unix
+// ones from Listen for instance, and hands them all to h. Close closes them.
+func ServeListeners(h Handler, listeners []net.Listener, opts ...Option) (*Server, error) {
+	if len(listeners) == 0 {
+		return nil, errors.New("no listener")
+	}
 	server := &Server{
-		Port:        port,
-		Listener:    l,
 		HandlerFunc: h,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	server.baseCtx, server.cancelBase = context.WithCancelCause(context.Background())
+	server.raw = listeners
+	for _, l := range listeners {
+		if server.proxyProto != nil {
+			pl := *server.proxyProto
+			pl.Listener = l
+			l = &pl
+		}
+		if server.tlsConfig != nil {
+			cfg := server.tlsConfig
+			if server.clientCAs != nil {
+				cfg = cfg.Clone()
+				cfg.ClientCAs = server.clientCAs
+				cfg.ClientAuth = server.clientAuth
+			}
+			l = tls.NewListener(l, cfg)
+		}
+		server.Listeners = append(server.Listeners, l)
+	}
+	server.Listener = server.Listeners[0]
 
-	go server.listen()
+	for _, l := range server.Listeners {
+		server.loops.Add(1)
+		go server.listen(l)
+	}
 
 	return server, nil
 }
 
+// Close stops accepting connections and cancels the requests in progress.
+// The listeners already closed, by Shutdown or Upgrade, are skipped.
 func (s *Server) Close() error {
 	s.IsClosed.Store(true)
-	err := s.Listener.Close()
-	if err != nil {
-		log.Fatalln(err)
+	var errs []error
+	for _, l := range s.Listeners {
+		err := l.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	s.cancelBase(ErrServerClosed)
+	return errors.Join(errs...)
+}
+
+// Shutdown stops accepting connections and waits for the ones in progress
+// to be answered, until ctx is done: their requests are then cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.IsClosed.Store(true)
+	for _, l := range s.Listeners {
+		l.Close()
+	}
+	// plus d'Accept après ça, conns ne peut plus que décroître
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	defer s.cancelBase(ErrServerClosed)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
 
-func (s *Server) listen() {
+func (s *Server) listen(l net.Listener) {
+	defer s.loops.Done()
+	var delay time.Duration
 	for !s.IsClosed.Load() {
-		conn, err := s.Listener.Accept()
-		fmt.Println("New connection !")
-		if err != nil && !s.IsClosed.Load() {
-			fmt.Println(err)
-			break
+		conn, err := l.Accept()
+		if err != nil {
+			if s.IsClosed.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// trop de fichiers ouverts par exemple : on réessaie un peu après
+			delay = min(max(2*delay, acceptMinDelay), acceptMaxDelay)
+			s.log().Error("accept failed", "addr", l.Addr().String(), "err", err, "retry_in", delay)
+			time.Sleep(delay)
+			continue
 		}
+		delay = 0
 		if conn != nil {
-			go s.handle(conn)
+			s.conns.Add(1)
+			id := s.lastConnID.Add(1)
+			go func() {
+				defer s.conns.Done()
+				s.handle(conn, id)
+			}()
 		}
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
+func (s *Server) handle(conn net.Conn, id uint64) {
 	defer conn.Close()
-	responseWriter := response.Writer{
+	logger := s.log().With("conn_id", id)
+	w := &response.Writer{
 		Connection: conn,
+		Log:        logger,
 	}
+	logger.Debug("connection accepted", "remote", conn.RemoteAddr().String())
 
-	req, err := request.RequestFromReader(conn)
+	var state *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		ctx, cancel := context.WithTimeout(s.baseCtx, handshakeTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			logger.Debug("TLS handshake failed", "err", err)
+			return
+		}
+		cs := tlsConn.ConnectionState()
+		state = &cs
+	}
+
+	br := bufio.NewReaderSize(conn, readBufferSize)
+	req, err := request.ReadRequest(br)
+	if errors.Is(err, io.EOF) {
+		logger.Debug("connection closed without request")
+		return
+	}
 	if err != nil {
-		fmt.Println(err)
+		logger.Debug("invalid request", "err", err)
 		return
 	}
-	req.Print()
-	defer fmt.Println(
-		"Server processed the request.\nWaiting another connection...",
-	)
+	req.ReceivedAt = time.Now()
+	if addr := conn.RemoteAddr(); addr != nil {
+		req.RemoteAddr = addr.String()
+	}
+	if addr := conn.LocalAddr(); addr != nil {
+		req.LocalAddr = addr.String()
+	}
+	req.TLS = state
+	// une seule requête par connexion tant qu'il n'y a pas de keep-alive
+	req.ConnID, req.Seq = id, 1
+
+	ctx, cancel := context.WithCancelCause(s.baseCtx)
+	defer cancel(nil)
+	if s.requestTimeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeoutCause(ctx, s.requestTimeout, ErrRequestTimeout)
+		defer stop()
+	}
+	req = req.WithContext(ctx)
+	cl, err := req.Headers.Get("content-length")
+	bodiless := err != nil || cl == "0"
+	if bodiless {
+		go watchClose(br, cancel)
+	}
+	defer func() {
+		logger.Info("request",
+			"remote", req.RemoteAddr,
+			"method", req.RequestLine.Method,
+			"path", req.RequestLine.RequestTarget,
+			"status", int(w.StatusCode()),
+			"duration", time.Since(req.ReceivedAt),
+		)
+	}()
+
+	_, err = req.Headers.Get("expect")
+	expect := err == nil
+	if expect {
+		if !req.ExpectContinue() {
+			reject(w, response.StatusExpectationFailed)
+			return
+		}
+		// Le 100 Continue n'est envoyé que si le handler lit le body
+		// avant d'avoir répondu, il peut donc encore refuser en 417 ou 413.
+		req.OnFirstBodyRead(func() error {
+			if w.State() != response.WriterStatusLine {
+				return nil
+			}
+			return w.WriteInterim(response.StatusContinue, nil)
+		})
+	}
+
+	if s.maxDecodedLen > 0 {
+		err = req.DecompressBody(s.maxDecodedLen)
+		if errors.Is(err, request.ErrUnsupportedEncoding) {
+			w.Header().Set("Accept-Encoding", "gzip, deflate")
+			reject(w, response.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	// sans Expect le client envoie le body d'emblée, il est lu dans Body
+	// avant le handler. Seul celui qui attend le 100 Continue est streamé.
+	if !expect && !bodiless {
+		_, err = req.ReadBody()
+		if errors.Is(err, request.ErrBodyTooLarge) {
+			reject(w, response.StatusContentTooLarge)
+			return
+		}
+		if err != nil {
+			logger.Debug("reading body failed", "err", err)
+			return
+		}
+		go watchClose(br, cancel)
+	}
+	if s.compress && req.RequestLine.Method != request.HEAD {
+		w.EnableCompression(req.Headers)
+	}
 
-	s.HandlerFunc(responseWriter, req)
+	s.HandlerFunc(w, req)
+	err = w.Close()
+	if err != nil {
+		logger.Error("closing response failed", "err", err)
+	}
+	err = req.RemoveTempFiles()
+	if err != nil {
+		logger.Error("removing temporary files failed", "err", err)
+	}
+}
+
+// Causes of the cancellation of a request context: the client went away
+// before the response, the server stops, or WithRequestTimeout expired.
+var (
+	ErrClientClosed   = errors.New("client closed the connection")
+	ErrServerClosed   = errors.New("server closed")
+	ErrRequestTimeout = errors.New("request timeout")
+)
+
+// watchClose cancels the request once the client closes the connection. It
+// only runs when the request has been entirely read, nothing else reads br.
+func watchClose(br *bufio.Reader, cancel context.CancelCauseFunc) {
+	_, err := br.Peek(1)
+	if err != nil {
+		cancel(ErrClientClosed)
+	}
+}
+
+func reject(w *response.Writer, statusCode tools.StatusCode) {
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+		return
+	}
+	err = w.WriteHeaders(response.GetDefaultHeaders(0))
+	if err != nil {
+		w.Logger().Error("writing response failed", "err", err)
+	}
 }
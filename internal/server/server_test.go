@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+func TestRequestMetadata(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	got := make(chan *request.Request, 1)
+	s, err := ServeListeners(func(w *response.Writer, req *request.Request) {
+		got <- req
+		echoTarget(w, req)
+	}, []net.Listener{l})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: Addresses, connection and time of the request
+	before := time.Now()
+	getOver(t, "tcp", l.Addr().String(), "/")
+	first := <-got
+	assert.Contains(t, first.RemoteAddr, "127.0.0.1:")
+	assert.Equal(t, l.Addr().String(), first.LocalAddr)
+	assert.Nil(t, first.TLS)
+	assert.Equal(t, 1, first.Seq)
+	assert.WithinRange(t, first.ReceivedAt, before, time.Now())
+
+	// Test: Each connection has its own ID
+	getOver(t, "tcp", l.Addr().String(), "/")
+	second := <-got
+	assert.NotZero(t, first.ConnID)
+	assert.Greater(t, second.ConnID, first.ConnID)
+	assert.NotEqual(t, first.RemoteAddr, second.RemoteAddr)
+}
+
+type ctxKey string
+
+func TestRequestContext(t *testing.T) {
+	causes := make(chan error, 1)
+	waitCancel := func(w *response.Writer, req *request.Request) {
+		<-req.Context().Done()
+		causes <- context.Cause(req.Context())
+		echoTarget(w, req)
+	}
+	withUser := func(h Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			ctx := context.WithValue(req.Context(), ctxKey("user"), "alice")
+			h(w, req.WithContext(ctx))
+		}
+	}
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListeners(func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/user":
+			withUser(func(w *response.Writer, req *request.Request) {
+				body := []byte(req.Context().Value(ctxKey("user")).(string))
+				w.WriteStatusLine(response.StatusOK)
+				w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+				w.WriteBody(body)
+			})(w, req)
+		default:
+			waitCancel(w, req)
+		}
+	}, []net.Listener{l}, WithRequestTimeout(200*time.Millisecond))
+	require.NoError(t, err)
+	addr := l.Addr().String()
+
+	// Test: Middleware adds values to the context
+	assert.Equal(t, "alice", getOver(t, "tcp", addr, "/user"))
+
+	// Test: The request deadline
+	assert.Equal(t, "/wait", getOver(t, "tcp", addr, "/wait"))
+	assert.ErrorIs(t, <-causes, ErrRequestTimeout)
+
+	// Test: The client closing the connection
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	io.WriteString(conn, "GET /wait HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+	assert.ErrorIs(t, <-causes, ErrClientClosed)
+
+	// Test: Shutdown cancels the requests still running at its deadline
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	io.WriteString(conn, "GET /wait HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-causes, ErrServerClosed)
+}
+
+// logBuffer collects the log lines written by the connection goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) lines() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	for {
+		var line map[string]any
+		if dec.Decode(&line) != nil {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	out := &logBuffer{}
+	logger := slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListeners(echoTarget, []net.Listener{l}, WithLogger(logger))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: One line per request with its fields
+	getOver(t, "tcp", l.Addr().String(), "/logged")
+	var req map[string]any
+	require.Eventually(t, func() bool {
+		for _, line := range out.lines() {
+			if line["msg"] == "request" {
+				req = line
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "INFO", req["level"])
+	assert.Equal(t, "GET", req["method"])
+	assert.Equal(t, "/logged", req["path"])
+	assert.EqualValues(t, 200, req["status"])
+	assert.NotZero(t, req["conn_id"])
+	assert.Contains(t, req["remote"], "127.0.0.1:")
+	assert.Contains(t, req, "duration")
+
+	// Test: The connection is logged at the debug level with the same ID
+	first := out.lines()[0]
+	assert.Equal(t, "connection accepted", first["msg"])
+	assert.Equal(t, "DEBUG", first["level"])
+	assert.Equal(t, req["conn_id"], first["conn_id"])
+
+	// Test: A bad request is logged at the debug level, the client is to blame
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	io.WriteString(conn, "BREW /pot HTTP/1.1\r\n\r\n")
+	io.ReadAll(conn)
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		for _, line := range out.lines() {
+			if line["msg"] == "invalid request" && line["level"] == "DEBUG" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	// Test: A discard handler silences the server, slog.Default included
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+	l2, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	quiet, err := ServeListeners(echoTarget, []net.Listener{l2},
+		WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+	defer quiet.Close()
+	n := len(out.lines())
+	assert.Equal(t, "/", getOver(t, "tcp", l2.Addr().String(), "/"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, out.lines(), n)
+}
+
+func TestExpectContinue(t *testing.T) {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/big" {
+			reject(w, response.StatusContentTooLarge)
+			return
+		}
+		if req.RequestLine.RequestTarget == "/filled" {
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(len(req.Body)))
+			w.WriteBody(req.Body)
+			return
+		}
+		// deux lectures, un seul 100
+		first := make([]byte, 2)
+		_, err := io.ReadFull(req.BodyReader(), first)
+		if err != nil {
+			return
+		}
+		rest, _ := io.ReadAll(req.BodyReader())
+		body := append(first, rest...)
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(s.Listener.Addr().(*net.TCPAddr).Port))
+	send := func(path, expect string) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = io.WriteString(conn, "POST "+path+" HTTP/1.1\r\nHost: localhost\r\n"+
+			"Expect: "+expect+"\r\nContent-Length: 5\r\n\r\n")
+		require.NoError(t, err)
+		return conn, bufio.NewReader(conn)
+	}
+
+	// Test: 100 Continue comes before the body, once for several reads
+	conn, br := send("/echo", "100-continue")
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 100, resp.StatusCode)
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: No 100 when the handler answers without reading the body
+	_, br = send("/big", "100-continue")
+	raw, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(raw), "HTTP/1.1 413 "), string(raw))
+	assert.NotContains(t, string(raw), " 100 ")
+
+	// Test: Another expectation is refused with 417
+	_, br = send("/echo", "something-else")
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 417, resp.StatusCode)
+
+	// Test: Without Expect, Body is filled before the handler runs
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST /filled HTTP/1.1\r\nHost: localhost\r\n"+
+		"Content-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestClose(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "http.sock")
+	unix, err := Listen("unix:" + sock)
+	require.NoError(t, err)
+	tcp, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListeners(echoTarget, []net.Listener{tcp, unix})
+	require.NoError(t, err)
+
+	// Test: Close after Shutdown returns, the listeners are already closed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.Close())
+	_, err = net.Dial("tcp", tcp.Addr().String())
+	assert.Error(t, err)
+}
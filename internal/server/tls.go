@@ -0,0 +1,180 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// handshakeTimeout bounds the TLS handshake of a new connection.
+const handshakeTimeout = 10 * time.Second
+
+// KeyPair names the PEM files of a certificate chain and of its key.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertStore holds the certificates served over TLS, picked by the server
+// name the client asks for (SNI). The first pair is the default one. They
+// can be loaded again while serving: the connections already open keep the
+// certificate they negotiated.
+type CertStore struct {
+	pairs []KeyPair
+
+	mu      sync.RWMutex
+	certs   []*tls.Certificate
+	names   map[string]*tls.Certificate
+	modTime map[string]time.Time
+}
+
+// NewCertStore loads the key pairs, at least one.
+func NewCertStore(pairs ...KeyPair) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	s := &CertStore{pairs: pairs}
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the files again. On error the certificates loaded before are
+// kept.
+func (s *CertStore) Reload() error {
+	certs := []*tls.Certificate{}
+	names := map[string]*tls.Certificate{}
+	modTime := map[string]time.Time{}
+	for _, p := range s.pairs {
+		for _, f := range []string{p.CertFile, p.KeyFile} {
+			info, err := os.Stat(f)
+			if err != nil {
+				return err
+			}
+			modTime[f] = info.ModTime()
+		}
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.CertFile, err)
+		}
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.CertFile, err)
+		}
+		certs = append(certs, &cert)
+
+		hosts := cert.Leaf.DNSNames
+		if len(hosts) == 0 && cert.Leaf.Subject.CommonName != "" {
+			hosts = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, h := range hosts {
+			// le premier certificat l'emporte pour un même nom
+			h = strings.ToLower(h)
+			if _, ok := names[h]; !ok {
+				names[h] = &cert
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs = certs
+	s.names = names
+	s.modTime = modTime
+	return nil
+}
+
+// GetCertificate picks the certificate for hello, to be used as
+// tls.Config.GetCertificate: exact name first, then a wildcard on the first
+// label, then the default one.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := s.names[name]; ok {
+		return cert, nil
+	}
+	if _, rest, ok := strings.Cut(name, "."); ok {
+		if cert, ok := s.names["*."+rest]; ok {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+// TLSConfig returns a server configuration serving the certificates of s.
+func (s *CertStore) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"http/1.1"},
+	}
+}
+
+// Watch reloads the certificates on SIGHUP, and when one of the files
+// changed, checked each interval (never when interval is 0), until stop is
+// called.
+func (s *CertStore) Watch(interval time.Duration) (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := &time.Ticker{}
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+			case <-ticker.C:
+				if !s.changed() {
+					continue
+				}
+			}
+			err := s.Reload()
+			if err != nil {
+				slog.Error("certificates not reloaded", "err", err)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		if interval > 0 {
+			ticker.Stop()
+		}
+		close(done)
+		<-finished
+	}
+}
+
+// changed reports whether a file has been modified since the last load.
+func (s *CertStore) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for f, t := range s.modTime {
+		info, err := os.Stat(f)
+		if err != nil {
+			// en cours de remplacement, on verra au prochain tour
+			continue
+		}
+		if !info.ModTime().Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/request"
+	"github.com/Lyra-poing-serre/HTTP-from-TCP/internal/response"
+)
+
+// writeCert writes a self-signed certificate named cn for hosts into dir.
+func writeCert(t *testing.T, dir, cn string, hosts ...string) KeyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := KeyPair{
+		CertFile: filepath.Join(dir, cn+".crt"),
+		KeyFile:  filepath.Join(dir, cn+".key"),
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(pair.CertFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(pair.KeyFile, keyPEM, 0o600))
+	return pair
+}
+
+func serveTLS(t *testing.T, store *CertStore) string {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		body := []byte(req.TLS.ServerName)
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, WithTLS(store.TLSConfig()))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s.Listener.Addr().String()
+}
+
+// get sends a request for serverName and returns the name of the certificate
+// served and the body.
+func get(t *testing.T, addr, serverName string) (string, string) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return exchange(t, conn)
+}
+
+func exchange(t *testing.T, conn *tls.Conn) (string, string) {
+	_, body, err := exchangePath(conn, "/")
+	require.NoError(t, err)
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, body
+}
+
+// exchangePath sends GET path on conn and returns the status and the body.
+func exchangePath(conn *tls.Conn, path string) (int, string, error) {
+	_, err := io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewCertStore(
+		writeCert(t, dir, "default", "example.com"),
+		writeCert(t, dir, "api", "api.example.com"),
+		writeCert(t, dir, "wildcard", "*.example.org"),
+	)
+	require.NoError(t, err)
+	addr := serveTLS(t, store)
+
+	// Test: The certificate is picked by SNI, the state is on the request
+	for name, want := range map[string]string{
+		"example.com":     "default",
+		"API.example.com": "api",
+		"www.example.org": "wildcard",
+		"example.org":     "default",
+		"unknown.test":    "default",
+	} {
+		cn, body := get(t, addr, name)
+		assert.Equal(t, want, cn, name)
+		assert.Equal(t, name, body)
+	}
+
+	// Test: Plain HTTP is refused
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.Error(t, err)
+
+	// Test: Files without certificate
+	_, err = NewCertStore(KeyPair{CertFile: filepath.Join(dir, "none.crt"), KeyFile: filepath.Join(dir, "none.key")})
+	assert.Error(t, err)
+	_, err = NewCertStore()
+	assert.Error(t, err)
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	pair := writeCert(t, dir, "site", "example.com")
+	store, err := NewCertStore(pair)
+	require.NoError(t, err)
+	addr := serveTLS(t, store)
+	serial := func(conn *tls.Conn) *big.Int {
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber
+	}
+
+	// Test: A connection open before the reload is still served
+	before, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer before.Close()
+	oldSerial := serial(before)
+	writeCert(t, dir, "site", "example.com")
+	require.NoError(t, store.Reload())
+	_, body := exchange(t, before)
+	assert.Equal(t, "example.com", body)
+
+	// Test: New connections get the new certificate
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	conn.Close()
+	assert.NotEqual(t, oldSerial, serial(conn))
+
+	// Test: A broken file keeps the certificate loaded
+	loaded := serial(conn)
+	require.NoError(t, os.WriteFile(pair.KeyFile, []byte("broken"), 0o600))
+	assert.Error(t, store.Reload())
+	conn, err = tls.Dial("tcp", addr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, loaded, serial(conn))
+
+	// Test: Watch reloads on file change
+	current := func() *big.Int {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		return store.certs[0].Leaf.SerialNumber
+	}
+	stop := store.Watch(10 * time.Millisecond)
+	writeCert(t, dir, "site", "example.com")
+	assert.Eventually(t, func() bool {
+		return current().Cmp(loaded) != 0
+	}, time.Second, 10*time.Millisecond)
+	stop()
+
+	// Test: And on SIGHUP
+	loaded = current()
+	stop = store.Watch(0)
+	defer stop()
+	writeCert(t, dir, "site", "example.com")
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		return current().Cmp(loaded) != 0
+	}, time.Second, 10*time.Millisecond)
+}
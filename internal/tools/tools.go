@@ -9,6 +9,9 @@ const CRLF = "\r\n"
 
 const ChunkSize int = 1024
 
+// TimeFormat is the IMF-fixdate layout of HTTP dates, always in GMT.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
 type (
 	StatusCode  int
 	WriterState int